@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Inject into every member of the array at once (i.e. ids[]=payload&ids[]=payload)
+	arrayModeGroup = "group"
+	// Add a new member to the array (i.e. filter[qsfuzz]=payload)
+	arrayModeNewKey = "newKey"
+	// Inject into the key inside the brackets (i.e. filter[payload]=red)
+	arrayModeKey = "key"
+
+	arrayNewKeyName = "qsfuzz"
+)
+
+var arrayModes = []string{arrayModeGroup, arrayModeNewKey, arrayModeKey}
+
+var numberedArrayRegex = regexp.MustCompile(`\[\d+\]`)
+
+func isValidArrayMode(mode string) bool {
+	for _, arrayMode := range arrayModes {
+		if strings.EqualFold(mode, arrayMode) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeArrayParam(param string) string {
+	return numberedArrayRegex.ReplaceAllString(param, "[]")
+}
+
+// Split a PHP-style parameter such as filter[color] into its base name and bracketed key
+func splitArrayParam(param string) (string, string, bool) {
+	open := strings.Index(param, "[")
+	if open <= 0 || !strings.HasSuffix(param, "]") {
+		return "", "", false
+	}
+	return param[:open], param[open+1 : len(param)-1], true
+}
+
+// Group parameter names by their array base name, i.e. ids[]/ids[1] are grouped under ids
+func getArrayGroups(queryStrings url.Values) map[string][]string {
+	groups := make(map[string][]string)
+	for param := range queryStrings {
+		base, _, ok := splitArrayParam(param)
+		if !ok {
+			continue
+		}
+		groups[base] = append(groups[base], param)
+	}
+
+	for base := range groups {
+		sort.Strings(groups[base])
+	}
+	return groups
+}
+
+func getInjectedArrayUrls(u *url.URL, ruleInjections []string, modes []string, decode bool) []Injection {
+	queryStrings, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil
+	}
+
+	groups := getArrayGroups(queryStrings)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	bases := make([]string, 0, len(groups))
+	for base := range groups {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, base := range bases {
+			params := groups[base]
+			for _, mode := range modes {
+				switch strings.ToLower(mode) {
+				case strings.ToLower(arrayModeGroup):
+					injected := cloneQueryStrings(queryStrings)
+					// Every member shares the same random values, since they're part of the same request
+					groupInjection := expandRequestTemplates(injection, base)
+					for _, param := range params {
+						for index := range injected[param] {
+							injected[param][index] = groupInjection
+						}
+					}
+					replacedUrls = appendArrayUrl(replacedUrls, u, base, injection, groupInjection, injected, decode)
+				case strings.ToLower(arrayModeNewKey):
+					injected := cloneQueryStrings(queryStrings)
+					// Numbered or empty arrays just get another member, named arrays get a new key
+					_, key, _ := splitArrayParam(params[0])
+					member := expandRequestTemplates(injection, base)
+					if key == "" {
+						injected.Add(base+"[]", member)
+					} else {
+						injected.Add(base+"["+arrayNewKeyName+"]", member)
+					}
+					replacedUrls = appendArrayUrl(replacedUrls, u, base, injection, member, injected, decode)
+				case strings.ToLower(arrayModeKey):
+					for _, param := range params {
+						injected := cloneQueryStrings(queryStrings)
+						key := expandRequestTemplates(injection, param)
+						injected[base+"["+key+"]"] = injected[param]
+						delete(injected, param)
+						replacedUrls = appendArrayUrl(replacedUrls, u, base, injection, key, injected, decode)
+					}
+				}
+			}
+		}
+	}
+	return replacedUrls
+}
+
+func appendArrayUrl(replacedUrls []Injection, u *url.URL, base string, injection string, sentPayload string, queryStrings url.Values, decode bool) []Injection {
+	rawQuery, err := encodeQueryStrings(queryStrings, u.RawQuery, decode)
+	if err != nil {
+		logParseError("Error decoding parameters: %v\n", err)
+		return replacedUrls
+	}
+
+	injectedUrl := *u
+	injectedUrl.RawQuery = rawQuery
+	return append(replacedUrls, Injection{Url: injectedUrl.String(), Param: base + "[]", Payload: injection, SentPayloads: []string{sentPayload}})
+}
+
+func cloneQueryStrings(queryStrings url.Values) url.Values {
+	cloned := make(url.Values, len(queryStrings))
+	for param, values := range queryStrings {
+		cloned[param] = append([]string(nil), values...)
+	}
+	return cloned
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// The Authorization header for -basic-auth and -bearer, where -bearer wins if both are set
+func getAuthorizationHeader(basicAuth string, bearer string) (string, error) {
+	if bearer != "" {
+		// Accept the token with or without the scheme, as it's often copied along with it
+		token := strings.TrimSpace(bearer)
+		if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+			token = strings.TrimSpace(token[len("bearer "):])
+		}
+		return "Bearer " + token, nil
+	}
+
+	if basicAuth != "" {
+		if !strings.Contains(basicAuth, ":") {
+			return "", errors.New("basic-auth flag not formatted properly (must be user:pass)")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(basicAuth)), nil
+	}
+	return "", nil
+}
+
+// Set a header, replacing any existing header with the same name regardless of case
+func setHeader(headers map[string]string, name string, value string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	for header := range headers {
+		if strings.EqualFold(header, name) {
+			delete(headers, header)
+		}
+	}
+	headers[name] = value
+	return headers
+}
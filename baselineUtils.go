@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The unfuzzed response for a URL, fetched once and shared by every rule that compares against it
+type baselineResponse struct {
+	once     sync.Once
+	response Response
+	err      error
+	// Counted once when the baseline is fetched, so word and line deltas don't recount it for every payload
+	counts bodyCounts
+}
+
+var baselineResponses = make(map[string]*baselineResponse)
+var baselineResponsesMutex sync.Mutex
+
+// Send the unfuzzed request for the task's URL with its original parameter values, once per URL. Rules that fuzz a
+// body get their own baseline with the original body, and each of the -methods its own, as they're different requests
+func getBaselineResponse(t Task) (Response, error) {
+	baseline := fetchBaseline(t)
+	return baseline.response, baseline.err
+}
+
+func getBaselineCounts(t Task) (bodyCounts, error) {
+	baseline := fetchBaseline(t)
+	return baseline.counts, baseline.err
+}
+
+func fetchBaseline(t Task) *baselineResponse {
+	key := t.TargetUrl + "\x00" + t.RuleData.getXmlBody() + "\x00" + t.RuleData.getJsonBody() + "\x00" + t.Method
+
+	baselineResponsesMutex.Lock()
+	baseline, exists := baselineResponses[key]
+	if !exists {
+		baseline = &baselineResponse{}
+		baselineResponses[key] = baseline
+	}
+	baselineResponsesMutex.Unlock()
+
+	baseline.once.Do(func() {
+		u, err := url.Parse(t.TargetUrl)
+		if err != nil {
+			baseline.err = err
+			return
+		}
+
+		baselineTask := t
+		baselineTask.Injection = getBaselineInjection(t.RuleData, u)
+		if t.Method != "" {
+			baselineTask.Method = t.Method
+		}
+		baseline.response, baseline.err = sendRequest(baselineTask)
+		baseline.counts = countBody(baseline.response.Body)
+	})
+	return baseline
+}
+
+func getBaselineInjection(ruleData Rule, u *url.URL) Injection {
+	if xmlBody := ruleData.getXmlBody(); xmlBody != "" {
+		return Injection{Url: u.String(), Method: "POST", Body: xmlBody, ContentType: xmlContentType}
+	}
+	if jsonBody := ruleData.getJsonBody(); jsonBody != "" {
+		return Injection{Url: u.String(), Method: "POST", Body: expandHeaderTemplates(jsonBody, u, ""), ContentType: jsonContentType}
+	}
+	// The -body content isn't fuzzed, so it's sent with the baseline as well
+	return addRequestBody(Injection{Url: u.String()}, u)
+}
+
+// Parse lengthDeltaGreaterThan, which is either a number of bytes (i.e. 500) or a percentage of the baseline (i.e. 20%)
+func parseLengthDelta(delta string) (float64, bool, error) {
+	delta = strings.TrimSpace(delta)
+	percent := strings.HasSuffix(delta, "%")
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(delta, "%")), 64)
+	if err != nil || value < 0 {
+		return 0, false, errors.New(fmt.Sprintf("invalid lengthDeltaGreaterThan %q (must be a number of bytes, i.e. 500, or a percentage, i.e. 20%%)", delta))
+	}
+	return value, percent, nil
+}
+
+// Check the response body's length differs from the baseline's by more than lengthDeltaGreaterThan, in either direction
+func matchesLengthDelta(resp Response, t Task, expectation ExpectedResponse) (string, bool) {
+	baseline, err := getBaselineResponse(t)
+	if err != nil {
+		return "", false
+	}
+
+	delta := float64(len(resp.Body) - len(baseline.Body))
+	if delta < 0 {
+		delta = -delta
+	}
+
+	if expectation.lengthDeltaPercent {
+		// Any change at all is an infinite increase on an empty baseline
+		if len(baseline.Body) > 0 {
+			delta = delta / float64(len(baseline.Body)) * 100
+		} else if delta > 0 {
+			delta = expectation.lengthDelta + 1
+		}
+	}
+
+	if delta <= expectation.lengthDelta {
+		return "", false
+	}
+	return fmt.Sprintf("response length %v, baseline %v", len(resp.Body), len(baseline.Body)), true
+}
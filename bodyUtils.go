@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Guess the Content-Type for the -body content, which can be overridden with a Content-Type header
+func detectBodyContentType(body string) string {
+	trimmed := strings.TrimSpace(body)
+	switch {
+	// Templates can make otherwise valid JSON unparseable (i.e. {"id": [[random]]}), so the opening bracket is enough
+	case json.Valid([]byte(trimmed)) || strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		return "application/json"
+	case strings.HasPrefix(trimmed, "<"):
+		return "application/xml"
+	case strings.Contains(trimmed, "=") && !strings.ContainsAny(trimmed, " \n"):
+		if _, err := url.ParseQuery(trimmed); err == nil {
+			return "application/x-www-form-urlencoded"
+		}
+	}
+	return "text/plain"
+}
+
+// Add the -body content to requests that don't already have a body of their own (i.e. from an XML body rule), with its
+// templates expanded against the URL being assessed like headers are
+func addRequestBody(injection Injection, u *url.URL) Injection {
+	if config.Body == "" || injection.Body != "" {
+		return injection
+	}
+	injection.Body = expandHeaderTemplates(config.Body, u, injection.Param)
+	injection.ContentType = config.BodyContentType
+	return injection
+}
+
+// Whether a header is set, as header names are case-insensitive
+func hasHeader(headers map[string]string, name string) bool {
+	for header := range headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
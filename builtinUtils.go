@@ -0,0 +1,96 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// A starter ruleset, so qsfuzz can be run without writing a config file first
+//
+//go:embed builtin-rules.yaml
+var builtinConfig string
+
+func getBuiltinRules() (map[string]Rule, error) {
+	var builtin Config
+	if _, err := unmarshalConfig(builtinConfig, "yaml", &builtin); err != nil {
+		return nil, err
+	}
+	return builtin.Rules, nil
+}
+
+// Add the builtin rules for -merge-builtin (or those selected by the config's builtin key, by name or tag), skipping
+// any the config file already has a rule with the same name for
+func mergeBuiltinRules(c *Config, selectors []string) error {
+	builtinRules, err := getBuiltinRules()
+	if err != nil {
+		return err
+	}
+	if selectors != nil {
+		if builtinRules, err = selectBuiltinRules(builtinRules, selectors); err != nil {
+			return err
+		}
+	}
+
+	if c.Rules == nil {
+		c.Rules = make(map[string]Rule)
+	}
+	if c.ruleSources == nil {
+		c.ruleSources = make(map[string]string)
+	}
+	for rule, ruleData := range builtinRules {
+		if _, exists := c.Rules[rule]; !exists {
+			c.Rules[rule] = ruleData
+			c.ruleSources[rule] = "builtin"
+		}
+	}
+	return nil
+}
+
+func selectBuiltinRules(builtinRules map[string]Rule, selectors []string) (map[string]Rule, error) {
+	selected := make(map[string]Rule)
+	for _, selector := range selectors {
+		pattern := strings.ToLower(strings.TrimSpace(selector))
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("builtin: invalid rule pattern %v: %v", selector, err))
+		}
+
+		found := false
+		for rule, ruleData := range builtinRules {
+			if matchesRulePattern(rule, pattern) || containsFold(ruleData.Tags, pattern) {
+				selected[rule] = ruleData
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.New(fmt.Sprintf("builtin: no builtin rule is named or tagged %v (see -list-builtin)", selector))
+		}
+	}
+	return selected, nil
+}
+
+func listBuiltinRules() error {
+	builtinRules, err := getBuiltinRules()
+	if err != nil {
+		return err
+	}
+	return listRules(builtinRules)
+}
+
+// Write the builtin config for -dump-builtin-config, to stdout with "-". Existing files are never overwritten, as
+// they're likely an earlier dump that's since been customized
+func dumpBuiltinConfig(path string) error {
+	if path == "-" {
+		_, err := fmt.Print(builtinConfig)
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return errors.New(fmt.Sprintf("%v already exists, so the builtin config wasn't written to it", path))
+	}
+	return ioutil.WriteFile(path, []byte(builtinConfig), 0644)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How often the -checkpoint file is rewritten while work items are completing
+const checkpointInterval = 10 * time.Second
+
+// A unit of work for -checkpoint: every request a rule sends for one parameter of an input URL
+type checkpointItem struct {
+	Url   string `json:"url"`
+	Rule  string `json:"rule"`
+	Param string `json:"param"`
+}
+
+type checkpointFile struct {
+	Completed []checkpointItem `json:"completed"`
+}
+
+// The work items that have finished, and how many requests are still queued for those in progress
+type checkpoint struct {
+	mutex     sync.Mutex
+	path      string
+	completed map[checkpointItem]bool
+	pending   map[checkpointItem]int
+	resumed   int
+	skipped   int
+	dirty     bool
+	lastWrite time.Time
+}
+
+// Set from -checkpoint
+var scanCheckpoint *checkpoint
+
+func getCheckpointItem(t Task) checkpointItem {
+	return checkpointItem{Url: t.TargetUrl, Rule: t.RuleName, Param: t.Param}
+}
+
+// Load the -checkpoint file if it exists, so a previous run's completed work items are skipped, or start a new one
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, completed: make(map[checkpointItem]bool), pending: make(map[checkpointItem]int), lastWrite: time.Now()}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read checkpoint: %v", err))
+	}
+
+	var file checkpointFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, errors.New(fmt.Sprintf("checkpoint %v is not a valid checkpoint file: %v", path, err))
+	}
+	for _, item := range file.Completed {
+		c.completed[item] = true
+	}
+	c.resumed = len(c.completed)
+	return c, nil
+}
+
+// Drop the tasks of work items a previous run completed, and count the requests left for the rest, so the checkpoint
+// knows when each finishes. This has to happen before the tasks are queued, as a worker could finish one straight away
+func (c *checkpoint) addTasks(tasks []Task) []Task {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	remaining := tasks[:0]
+	skippedItems := make(map[checkpointItem]bool)
+	for _, task := range tasks {
+		item := getCheckpointItem(task)
+		if c.completed[item] {
+			skippedItems[item] = true
+			continue
+		}
+		c.pending[item] += 1
+		remaining = append(remaining, task)
+	}
+	c.skipped += len(skippedItems)
+	return remaining
+}
+
+// Mark one of a work item's requests as done (sent, failed or skipped by -stop-on-first), completing the item with
+// its last request. The file is rewritten at most every checkpointInterval
+func (c *checkpoint) finishTask(t Task) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	item := getCheckpointItem(t)
+	c.pending[item] -= 1
+	if c.pending[item] > 0 {
+		return
+	}
+	delete(c.pending, item)
+	c.completed[item] = true
+	c.dirty = true
+
+	if time.Since(c.lastWrite) >= checkpointInterval {
+		c.write()
+	}
+}
+
+// Write the checkpoint to a temporary file next to it and rename it into place, so a run killed mid-write never
+// leaves a truncated checkpoint. Must be called with the mutex held
+func (c *checkpoint) write() {
+	c.lastWrite = time.Now()
+	if !c.dirty {
+		return
+	}
+
+	file := checkpointFile{Completed: make([]checkpointItem, 0, len(c.completed))}
+	for item := range c.completed {
+		file.Completed = append(file.Completed, item)
+	}
+	sort.Slice(file.Completed, func(i, j int) bool {
+		a, b := file.Completed[i], file.Completed[j]
+		if a.Url != b.Url {
+			return a.Url < b.Url
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Param < b.Param
+	})
+
+	if err := writeFileAtomically(c.path, file); err != nil {
+		printRed(os.Stderr, "error writing checkpoint %v: %v\n", c.path, err)
+		return
+	}
+	c.dirty = false
+}
+
+func writeFileAtomically(path string, value interface{}) error {
+	// URLs are kept readable, rather than with & escaped as \u0026
+	var contents bytes.Buffer
+	encoder := json.NewEncoder(&contents)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(contents.Bytes()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func (c *checkpoint) save() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.write()
+}
+
+// Save the checkpoint when the run is interrupted (i.e. with Ctrl-C), so work completed since the last periodic write
+// isn't lost
+func (c *checkpoint) saveOnInterrupt() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		c.save()
+		printCyan(os.Stderr, "Interrupted, saved checkpoint to %v (re-run with the same -checkpoint to resume)\n", c.path)
+		os.Exit(exitCodeError)
+	}()
+}
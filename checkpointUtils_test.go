@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func checkpointTask(url string, rule string, param string) Task {
+	task := Task{TargetUrl: url, RuleName: rule}
+	task.Param = param
+	return task
+}
+
+// A work item only completes with its last request, and completed items are saved and skipped when resuming
+func TestCheckpointBookkeeping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+	c, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []Task{
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "a"),
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "a"),
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "b"),
+		checkpointTask("https://example.com/?a=1&b=2", "sqli", "a"),
+	}
+	if remaining := c.addTasks(tasks); len(remaining) != 4 {
+		t.Fatalf("addTasks kept %v of a new checkpoint's tasks, want 4", len(remaining))
+	}
+
+	xssA := getCheckpointItem(tasks[0])
+	c.finishTask(tasks[0])
+	if c.completed[xssA] || c.pending[xssA] != 1 {
+		t.Errorf("after 1 of 2 requests, xss a is completed %v with %v pending, want false with 1", c.completed[xssA], c.pending[xssA])
+	}
+	c.finishTask(tasks[1])
+	c.finishTask(tasks[2])
+	if !c.completed[xssA] || !c.completed[getCheckpointItem(tasks[2])] {
+		t.Errorf("completed = %v, want xss a and b", c.completed)
+	}
+	if _, ok := c.pending[xssA]; ok {
+		t.Errorf("xss a is still pending after completing")
+	}
+	c.save()
+
+	resumed, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.resumed != 2 {
+		t.Errorf("resumed %v completed items, want 2", resumed.resumed)
+	}
+	remaining := resumed.addTasks([]Task{
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "a"),
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "a"),
+		checkpointTask("https://example.com/?a=1&b=2", "xss", "b"),
+		checkpointTask("https://example.com/?a=1&b=2", "sqli", "a"),
+		checkpointTask("https://example.com/?c=3", "xss", "c"),
+	})
+	if len(remaining) != 2 || remaining[0].RuleName != "sqli" || remaining[1].Param != "c" {
+		t.Errorf("addTasks kept %v, want the sqli a and xss c tasks", remaining)
+	}
+	// Skipped counts work items rather than requests
+	if resumed.skipped != 2 {
+		t.Errorf("skipped %v work items, want 2", resumed.skipped)
+	}
+}
+
+// Only work items that completed are written, so a run interrupted mid-item resends all of its requests
+func TestCheckpointSaveSkipsPending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+	c, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []Task{checkpointTask("https://example.com/?a=1", "xss", "a"), checkpointTask("https://example.com/?a=1", "xss", "a")}
+	c.addTasks(tasks)
+	c.finishTask(tasks[0])
+	c.save()
+	if _, err := ioutil.ReadFile(path); err == nil {
+		t.Errorf("checkpoint was written without any completed work items")
+	}
+
+	c.finishTask(tasks[1])
+	c.save()
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "completed": [
+    {
+      "url": "https://example.com/?a=1",
+      "rule": "xss",
+      "param": "a"
+    }
+  ]
+}
+`
+	if string(contents) != want {
+		t.Errorf("checkpoint = %s, want %s", contents, want)
+	}
+}
+
+func TestLoadCheckpointInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+	if err := ioutil.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Errorf("loadCheckpoint of an invalid file = nil, want an error")
+	}
+}
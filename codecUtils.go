@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	codecBase64    = "base64"
+	codecBase64Url = "base64url"
+
+	codecModeReplace = "replace"
+	codecModeAppend  = "append"
+)
+
+// Decode a parameter value with the rule's codec, returning the encoding that worked so the injected value
+// can be re-encoded the same way (padded or not)
+func decodeParamValue(value string, codec string) (string, *base64.Encoding, bool) {
+	var encodings []*base64.Encoding
+	switch strings.ToLower(codec) {
+	case codecBase64:
+		encodings = []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding}
+	case codecBase64Url:
+		encodings = []*base64.Encoding{base64.URLEncoding, base64.RawURLEncoding}
+	}
+
+	if value == "" {
+		return "", nil, false
+	}
+
+	for _, encoding := range encodings {
+		decoded, err := encoding.DecodeString(value)
+		// Plenty of regular words are valid base64, so only count values that decode to readable text
+		if err != nil || !utf8.Valid(decoded) {
+			continue
+		}
+		return string(decoded), encoding, true
+	}
+	return "", nil, false
+}
+
+// Inject into the decoded form of each encoded parameter value (and into each string leaf if the decoded value
+// is JSON and the rule asks for it), re-encoding before sending. Values that don't decode are skipped
+func getInjectedCodecUrls(u *url.URL, ruleInjections []string, ruleData Rule) ([]Injection, error) {
+	queryStrings, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	appendPayload := strings.EqualFold(ruleData.ValueCodecMode, codecModeAppend)
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, qs := range getSortedParams(queryStrings) {
+			for index, val := range queryStrings[qs] {
+				decoded, encoding, ok := decodeParamValue(val, ruleData.ValueCodec)
+				if !ok {
+					continue
+				}
+
+				var variants []ValueVariant
+				if ruleData.ValueCodecJson {
+					variants, _ = getInjectedJsonValues(decoded, qs, injection, appendPayload)
+				}
+
+				if variants == nil {
+					payload := expandRequestTemplates(injection, qs)
+					injected := payload
+					if appendPayload {
+						injected = decoded + injected
+					}
+					variants = []ValueVariant{{Value: injected, Payload: payload}}
+				}
+
+				for _, variant := range variants {
+					queryStrings[qs][index] = encoding.EncodeToString([]byte(variant.Value))
+					rawQuery, err := encodeQueryStrings(queryStrings, u.RawQuery, ruleData.decodesParams())
+
+					// Set back to original qs val to ensure we only update one parameter at a time
+					queryStrings[qs][index] = val
+
+					if err != nil {
+						logParseError("Error decoding parameters: %v\n", err)
+						continue
+					}
+
+					location := fmt.Sprintf("%v %v", strings.ToLower(ruleData.ValueCodec), describeParam(qs, index, len(queryStrings[qs])))
+					if variant.Path != "" {
+						location = fmt.Sprintf("%v in %v", variant.Path, location)
+					}
+
+					injectedUrl := *u
+					injectedUrl.RawQuery = rawQuery
+					replacedUrls = append(replacedUrls, Injection{Url: injectedUrl.String(), Param: qs, Location: location, Payload: injection, SentPayloads: []string{variant.Payload}})
+				}
+			}
+		}
+	}
+	return replacedUrls, nil
+}
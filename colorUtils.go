@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"os"
+)
+
+// Whether f is a terminal, rather than a file or pipe that would end up with ANSI color codes in it
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Turn colors off for -no-color or the NO_COLOR environment variable (see https://no-color.org), and for each of
+// stdout and stderr when it isn't a terminal (i.e. redirected to a log file). The color package only checks stdout
+// itself, so printRed and printCyan, which print to stderr, are checked against stderr here
+func setupColors(noColor bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		color.NoColor = true
+		return
+	}
+
+	color.NoColor = !isTerminal(os.Stdout)
+	red, cyan := color.New(color.FgRed), color.New(color.FgCyan)
+	if isTerminal(os.Stderr) {
+		red.EnableColor()
+		cyan.EnableColor()
+	} else {
+		red.DisableColor()
+		cyan.DisableColor()
+	}
+	printRed, printCyan = red.FprintfFunc(), cyan.FprintfFunc()
+}
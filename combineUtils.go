@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Every combination of size parameters, in sorted order and capped at maxCombos (0 for no cap)
+func getParamCombinations(params []string, size int, maxCombos int) [][]string {
+	var combinations [][]string
+	if size < 2 || size > len(params) {
+		return combinations
+	}
+
+	indexes := make([]int, size)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	for {
+		combination := make([]string, size)
+		for i, index := range indexes {
+			combination[i] = params[index]
+		}
+		combinations = append(combinations, combination)
+		if maxCombos > 0 && len(combinations) >= maxCombos {
+			return combinations
+		}
+
+		// Move on to the next combination, advancing the rightmost index that still has room
+		i := size - 1
+		for i >= 0 && indexes[i] == len(params)-size+i {
+			i--
+		}
+		if i < 0 {
+			return combinations
+		}
+		indexes[i]++
+		for j := i + 1; j < size; j++ {
+			indexes[j] = indexes[j-1] + 1
+		}
+	}
+}
+
+// Inject into combinations of parameters at once (i.e. pairs with -combine 2), for vulnerabilities that need more
+// than one tainted parameter. Every value of each parameter in the combination is replaced
+func getInjectedCombinedUrls(u *url.URL, ruleInjections []string, size int, maxCombos int, decode bool) ([]Injection, error) {
+	queryStrings, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	combinations := getParamCombinations(getSortedParams(queryStrings), size, maxCombos)
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, combination := range combinations {
+			injected := cloneQueryStrings(queryStrings)
+			var sentPayloads []string
+			for _, qs := range combination {
+				for index := range injected[qs] {
+					payload := expandRequestTemplates(injection, qs)
+					injected[qs][index] = payload
+					sentPayloads = append(sentPayloads, payload)
+				}
+			}
+
+			rawQuery, err := encodeQueryStrings(injected, u.RawQuery, decode)
+			if err != nil {
+				logParseError("Error decoding parameters: %v\n", err)
+				continue
+			}
+
+			params := strings.Join(combination, ", ")
+			injectedUrl := *u
+			injectedUrl.RawQuery = rawQuery
+			replacedUrls = append(replacedUrls, Injection{Url: injectedUrl.String(), Param: params, Location: params, Payload: injection, SentPayloads: sentPayloads})
+		}
+	}
+	return replacedUrls, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Check each of the rule's content types is a media type or wildcard pattern (i.e. application/json, text/* or
+// */*+json), lowercasing them to match against responses. They're copied, as the config's may be shared when reloading
+func validateContentTypes(ruleData Rule) (Rule, error) {
+	if ruleData.ContentTypes == nil {
+		return ruleData, nil
+	}
+
+	contentTypes := make([]string, 0, len(ruleData.ContentTypes))
+	for i, contentType := range ruleData.ContentTypes {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if !strings.Contains(contentType, "/") {
+			return ruleData, errors.New(fmt.Sprintf("contentType[%v]: %q should be a media type, i.e. application/json or text/*", i, contentType))
+		}
+		if _, err := path.Match(contentType, ""); err != nil {
+			return ruleData, errors.New(fmt.Sprintf("contentType[%v]: invalid pattern %q: %v", i, contentType, err))
+		}
+		contentTypes = append(contentTypes, contentType)
+	}
+	ruleData.ContentTypes = contentTypes
+	return ruleData, nil
+}
+
+// Whether a response's Content-Type is one the rule is evaluated against. Parameters like charset are ignored, and
+// rules without content types are evaluated against every response
+func (r Rule) matchesContentType(headers http.Header) bool {
+	if len(r.ContentTypes) == 0 {
+		return true
+	}
+
+	contentType := getMediaType(headers.Get("Content-Type"))
+	for _, pattern := range r.ContentTypes {
+		if matched, _ := path.Match(pattern, contentType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func getMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Keep what's before any parameters of a malformed header, rather than treating it as missing
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	return strings.ToLower(mediaType)
+}
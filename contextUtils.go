@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Response text around a responseContents or bodyRegex match, for -context
+type MatchContext struct {
+	Matcher string
+	Context string
+}
+
+func (c MatchContext) String() string {
+	return fmt.Sprintf("%v %q", c.Matcher, c.Context)
+}
+
+// The -context characters either side of the span text[start:end], moved onto UTF-8 boundaries, with ... where the
+// text was cut off
+func getContextAround(text string, start int, end int) string {
+	before, after := start-opts.Context, end+opts.Context
+	if before < 0 {
+		before = 0
+	}
+	if after > len(text) {
+		after = len(text)
+	}
+	for before > 0 && !utf8.RuneStart(text[before]) {
+		before -= 1
+	}
+	for after < len(text) && !utf8.RuneStart(text[after]) {
+		after += 1
+	}
+
+	context := text[before:after]
+	if before > 0 {
+		context = "..." + context
+	}
+	if after < len(text) {
+		context += "..."
+	}
+	return context
+}
+
+// Find the surrounding text of the expectation's first responseContents and bodyRegex matches, which are looked for
+// the same way they were matched: substrings by index (ignoring case as configured) and regexes by their match span
+func getMatchContexts(resp Response, expectation ExpectedResponse) []MatchContext {
+	if opts.Context <= 0 {
+		return nil
+	}
+
+	var contexts []MatchContext
+	text := getResponsePart(resp, expectation.partFor("responseContents"))
+	ignoreCase := expectation.ignoresCaseFor("responseContents")
+	searched := text
+	if ignoreCase {
+		searched = strings.ToLower(text)
+	}
+	// Lowercasing can change the length of some characters, in which case the lowercase text is shown so the index
+	// still lines up
+	shown := text
+	if len(searched) != len(text) {
+		shown = searched
+	}
+	for _, content := range expectation.Contents {
+		if ignoreCase {
+			content = strings.ToLower(content)
+		}
+		if index := strings.Index(searched, content); index >= 0 {
+			contexts = append(contexts, MatchContext{Matcher: "responseContents", Context: getContextAround(shown, index, index+len(content))})
+			break
+		}
+	}
+
+	text = getResponsePart(resp, expectation.partFor("bodyRegex"))
+	for _, regex := range expectation.bodyRegexes {
+		if location := regex.FindStringIndex(text); location != nil {
+			contexts = append(contexts, MatchContext{Matcher: "bodyRegex", Context: getContextAround(text, location[0], location[1])})
+			break
+		}
+	}
+	return contexts
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Matches are counted up to this many for minCount, so a regex matching every character of a huge body stops early
+const maxCountedMatches = 1000
+
+// The matchers a minCount applies to
+var minCountMatchers = []string{"responseContents", "bodyRegex"}
+
+// Conditions on a word or line count, all of which need to hold (i.e. gt: 10 and lt: 50 for a range)
+type CountCondition struct {
+	Gt *int `mapstructure:"gt"`
+	Lt *int `mapstructure:"lt"`
+	Eq *int `mapstructure:"eq"`
+}
+
+// The word and line counts of a response body, which are cheap signals for boolean based differences in pages
+// that don't change much in length
+type bodyCounts struct {
+	words int
+	lines int
+}
+
+func countBody(body string) bodyCounts {
+	lines := strings.Count(body, "\n")
+	// The last line only counts when it isn't empty, so a trailing newline doesn't add one
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		lines += 1
+	}
+	return bodyCounts{words: len(strings.Fields(body)), lines: lines}
+}
+
+func validateCountCondition(field string, condition *CountCondition) error {
+	if condition == nil {
+		return nil
+	}
+	if condition.Gt == nil && condition.Lt == nil && condition.Eq == nil {
+		return errors.New(fmt.Sprintf("%v: must set at least one of gt, lt or eq", field))
+	}
+	for _, value := range []*int{condition.Gt, condition.Lt, condition.Eq} {
+		if value != nil && *value < 0 {
+			return errors.New(fmt.Sprintf("%v: counts can't be negative, got %v", field, *value))
+		}
+	}
+	if condition.Gt != nil && condition.Lt != nil && *condition.Lt-*condition.Gt < 2 {
+		return errors.New(fmt.Sprintf("%v: no count is greater than %v and less than %v", field, *condition.Gt, *condition.Lt))
+	}
+	return nil
+}
+
+func validateCountConditions(expectation ExpectedResponse) error {
+	conditions := []struct {
+		field     string
+		condition *CountCondition
+	}{
+		{"words", expectation.Words},
+		{"lines", expectation.Lines},
+		{"wordsDeltaFromBaseline", expectation.WordsDeltaFromBaseline},
+		{"linesDeltaFromBaseline", expectation.LinesDeltaFromBaseline},
+	}
+	for _, c := range conditions {
+		if err := validateCountCondition(c.field, c.condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c CountCondition) matches(count int) bool {
+	return (c.Gt == nil || count > *c.Gt) && (c.Lt == nil || count < *c.Lt) && (c.Eq == nil || count == *c.Eq)
+}
+
+func (c CountCondition) String() string {
+	var parts []string
+	if c.Gt != nil {
+		parts = append(parts, fmt.Sprintf("gt %v", *c.Gt))
+	}
+	if c.Lt != nil {
+		parts = append(parts, fmt.Sprintf("lt %v", *c.Lt))
+	}
+	if c.Eq != nil {
+		parts = append(parts, fmt.Sprintf("eq %v", *c.Eq))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Each absolute count is a check of its own, while the deltas are deferred as they need the baseline
+func (e ExpectedResponse) countCountChecks() (int, int) {
+	checks, deferred := 0, 0
+	for _, used := range []bool{e.Words != nil, e.Lines != nil} {
+		if used {
+			checks += 1
+		}
+	}
+	for _, used := range []bool{e.WordsDeltaFromBaseline != nil, e.LinesDeltaFromBaseline != nil} {
+		if used {
+			deferred += 1
+		}
+	}
+	return checks, deferred
+}
+
+// Match the expectation's words and lines conditions against the body, returning how many of them matched with the
+// count that matched for each
+func matchCounts(body string, expectation ExpectedResponse) (int, []string) {
+	if expectation.Words == nil && expectation.Lines == nil {
+		return 0, nil
+	}
+
+	counts := countBody(body)
+	checksMatched := 0
+	var matchDetails []string
+	if expectation.Words != nil && expectation.Words.matches(counts.words) {
+		checksMatched += 1
+		matchDetails = append(matchDetails, fmt.Sprintf("words %v (%v)", counts.words, expectation.Words))
+	}
+	if expectation.Lines != nil && expectation.Lines.matches(counts.lines) {
+		checksMatched += 1
+		matchDetails = append(matchDetails, fmt.Sprintf("lines %v (%v)", counts.lines, expectation.Lines))
+	}
+	return checksMatched, matchDetails
+}
+
+// Check how much the body's word or line count differs from the baseline's, in either direction, against condition.
+// The baseline's counts are computed once along with its response
+func matchesCountDelta(resp Response, t Task, field string, condition CountCondition) (string, bool) {
+	baseline, err := getBaselineCounts(t)
+	if err != nil {
+		return "", false
+	}
+
+	counts := countBody(resp.Body)
+	count, baselineCount := counts.words, baseline.words
+	if field == "lines" {
+		count, baselineCount = counts.lines, baseline.lines
+	}
+
+	delta := count - baselineCount
+	if delta < 0 {
+		delta = -delta
+	}
+	if !condition.matches(delta) {
+		return "", false
+	}
+	return fmt.Sprintf("%v %v, baseline %v, delta %v (%v)", field, count, baselineCount, delta, condition), true
+}
+
+func validateMinCounts(expectation ExpectedResponse) error {
+	if expectation.MinCount < 0 || expectation.MinCount > maxCountedMatches {
+		return errors.New(fmt.Sprintf("minCount: must be between 1 and %v, got %v", maxCountedMatches, expectation.MinCount))
+	}
+	for name, minCount := range expectation.MinCounts {
+		if !containsFold(minCountMatchers, name) {
+			return errors.New(fmt.Sprintf("minCounts: unknown matcher %v (must be one of %v)", name, strings.Join(minCountMatchers, ", ")))
+		}
+		if minCount < 1 || minCount > maxCountedMatches {
+			return errors.New(fmt.Sprintf("minCounts.%v: must be between 1 and %v, got %v", name, maxCountedMatches, minCount))
+		}
+	}
+	// An empty value is found between every character, so it would meet any count
+	if expectation.minCountFor("responseContents") > 1 {
+		for i, content := range expectation.Contents {
+			if content == "" {
+				return errors.New(fmt.Sprintf("responseContents[%v]: can't be empty with a minCount above 1", i))
+			}
+		}
+	}
+	return nil
+}
+
+// How many times value is found in body, without overlapping, counted up to maxCountedMatches like regex matches
+func countSubstring(body string, value string) int {
+	count := 0
+	for count < maxCountedMatches {
+		index := strings.Index(body, value)
+		if index < 0 {
+			break
+		}
+		count += 1
+		body = body[index+len(value):]
+	}
+	return count
+}
+
+// How many times a matcher's value needs to be found, which is minCount unless minCounts overrides it for that matcher
+func (e ExpectedResponse) minCountFor(matcher string) int {
+	for name, minCount := range e.MinCounts {
+		if strings.EqualFold(name, matcher) {
+			return minCount
+		}
+	}
+	return e.MinCount
+}
+
+func describeMatchCount(count int) string {
+	if count >= maxCountedMatches {
+		return fmt.Sprintf("%v+ times", maxCountedMatches)
+	}
+	return fmt.Sprintf("%v times", count)
+}
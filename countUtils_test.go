@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCountSubstring(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		value string
+		want  int
+	}{
+		{"missing", "abc", "x", 0},
+		{"once", "abc", "b", 1},
+		{"several", "error: a, error: b, error: c", "error", 3},
+		{"not overlapping", "aaaa", "aa", 2},
+		{"capped", strings.Repeat("a", 5000), "a", maxCountedMatches},
+		{"at the cap", strings.Repeat("ab", maxCountedMatches), "ab", maxCountedMatches},
+	}
+
+	for _, test := range tests {
+		if got := countSubstring(test.body, test.value); got != test.want {
+			t.Errorf("%v: countSubstring = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Substring and regex matches are both counted up to maxCountedMatches, so their details read the same
+func TestEvaluateExpectationCapsCounts(t *testing.T) {
+	body := strings.Repeat("canary ", 2*maxCountedMatches)
+	tests := []struct {
+		name        string
+		expectation ExpectedResponse
+		want        string
+	}{
+		{"responseContents", ExpectedResponse{Contents: []string{"canary"}, MinCount: 2}, `responseContents "canary" found 1000+ times`},
+		{"bodyRegex", ExpectedResponse{BodyRegex: []string{"canary"}, MinCount: 2}, `bodyRegex /canary/ matched "canary" 1000+ times`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectation, err := loadExpectation(test.expectation, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := Response{StatusCode: 200, Body: body, Headers: http.Header{}}
+			_, details, matched := evaluateExpectation(resp, Task{}, expectation)
+			if !matched || !strings.Contains(strings.Join(details, "\n"), test.want) {
+				t.Errorf("evaluateExpectation = %v, matched %v, want details containing %q", details, matched, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateMinCountsEmptyContents(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation ExpectedResponse
+		err         string
+	}{
+		{"no minCount", ExpectedResponse{Contents: []string{"", "error"}}, ""},
+		{"minCount of 1", ExpectedResponse{Contents: []string{""}, MinCount: 1}, ""},
+		{"minCount", ExpectedResponse{Contents: []string{"error", ""}, MinCount: 3}, "responseContents[1]: can't be empty with a minCount above 1"},
+		{"minCounts", ExpectedResponse{Contents: []string{""}, MinCounts: map[string]int{"responsecontents": 2}}, "responseContents[0]: can't be empty"},
+		{"minCounts for another matcher", ExpectedResponse{Contents: []string{""}, BodyRegex: []string{"a"}, MinCounts: map[string]int{"bodyregex": 2}}, ""},
+	}
+
+	for _, test := range tests {
+		err := validateMinCounts(test.expectation)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%v: validateMinCounts = %v, want no error", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: validateMinCounts = %v, want an error containing %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Resolved addresses for a host, kept until they expire. Expired entries are still used if looking the host up again
+// fails, so a flaky resolver doesn't fail requests to hosts that were resolving fine moments ago
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// A lookup in progress, which concurrent dials to the same host wait on rather than each querying the resolver
+type dnsLookup struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+type dnsCache struct {
+	mutex    sync.Mutex
+	entries  map[string]dnsCacheEntry
+	lookups  map[string]*dnsLookup
+	ttl      time.Duration
+	maxSize  int
+	resolver *net.Resolver
+}
+
+func newDnsCache(ttlSeconds int, maxSize int) *dnsCache {
+	return &dnsCache{
+		entries:  make(map[string]dnsCacheEntry),
+		lookups:  make(map[string]*dnsLookup),
+		ttl:      time.Duration(ttlSeconds) * time.Second,
+		maxSize:  maxSize,
+		resolver: net.DefaultResolver,
+	}
+}
+
+// Wrap a dial function so hostnames are resolved through the cache, trying each of the host's addresses in turn until
+// one connects. IP addresses are dialed as they are
+func (c *dnsCache) wrapDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		addrs, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var conn net.Conn
+		for _, addr := range addrs {
+			conn, err = dial(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	c.mutex.Lock()
+	entry, cached := c.entries[host]
+	if cached && time.Now().Before(entry.expires) {
+		c.mutex.Unlock()
+		return entry.addrs, nil
+	}
+
+	lookup, inProgress := c.lookups[host]
+	if !inProgress {
+		lookup = &dnsLookup{done: make(chan struct{})}
+		c.lookups[host] = lookup
+	}
+	c.mutex.Unlock()
+
+	if !inProgress {
+		// The lookup isn't tied to the first dial's context, as the other dials waiting on it would fail with it
+		lookup.addrs, lookup.err = c.resolver.LookupHost(context.Background(), host)
+
+		c.mutex.Lock()
+		if lookup.err == nil {
+			c.store(host, lookup.addrs)
+		}
+		delete(c.lookups, host)
+		c.mutex.Unlock()
+		close(lookup.done)
+	}
+
+	select {
+	case <-lookup.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if lookup.err != nil {
+		if cached {
+			if opts.Debug {
+				printRed(os.Stderr, "unable to resolve %v, using its expired DNS cache entry: %v\n", host, lookup.err)
+			}
+			return entry.addrs, nil
+		}
+		return nil, lookup.err
+	}
+	return lookup.addrs, nil
+}
+
+// Store a host's addresses, making room when the cache is full by dropping expired entries, or failing that the
+// one closest to expiring. Must be called with the mutex held
+func (c *dnsCache) store(host string, addrs []string) {
+	if _, exists := c.entries[host]; !exists && c.maxSize > 0 && len(c.entries) >= c.maxSize {
+		now := time.Now()
+		oldestHost := ""
+		var oldest time.Time
+		for cachedHost, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, cachedHost)
+			} else if oldestHost == "" || entry.expires.Before(oldest) {
+				oldestHost, oldest = cachedHost, entry.expires
+			}
+		}
+		if len(c.entries) >= c.maxSize {
+			delete(c.entries, oldestHost)
+		}
+	}
+	c.entries[host] = dnsCacheEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+type requestCount struct {
+	Rule     string `json:"rule"`
+	Requests int    `json:"requests"`
+}
+
+// Count the requests each rule would send across the URLs for -count, generating their injections the same way a run
+// does but without sending anything
+func countRequests(urls []string, rules map[string]Rule) []requestCount {
+	counts := make([]requestCount, 0, len(rules))
+	for _, rule := range getSortedRuleNames(rules) {
+		ruleData := rules[rule]
+		count := requestCount{Rule: rule}
+		for _, u := range urls {
+			fullUrl, err := url.Parse(u)
+			if err != nil {
+				continue
+			}
+			injections, err := getRuleInjections(fullUrl, ruleData)
+			if err != nil {
+				continue
+			}
+			for _, injection := range injections {
+				count.Requests += len(getMethodInjections(addRequestBody(injection, fullUrl)))
+			}
+		}
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+// Print how many requests each rule would send, and the total, as a table (or as JSON with -json)
+func printRequestCounts(urls []string, rules map[string]Rule) error {
+	counts := countRequests(urls, rules)
+	total := 0
+	for _, count := range counts {
+		total += count.Requests
+	}
+
+	if opts.Json {
+		encoded, err := json.MarshalIndent(struct {
+			Urls     int            `json:"urls"`
+			Requests int            `json:"requests"`
+			Rules    []requestCount `json:"rules"`
+		}{len(urls), total, counts}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "RULE\tREQUESTS")
+	for _, count := range counts {
+		fmt.Fprintf(writer, "%v\t%v\n", count.Rule, count.Requests)
+	}
+	fmt.Fprintf(writer, "TOTAL\t%v\n", total)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// These depend on the responses, so they can't be known ahead of time
+	if !opts.SilentMode {
+		printCyan(os.Stderr, "Across %v URLs. Baseline requests, retries, delay confirmations and verify steps are sent on top of these as needed\n", len(urls))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Bodies are cut off at this size before being passed to matcher expressions, so huge responses aren't copied into
+// the evaluator. contentLength still has the full length
+const expressionMaxBodySize = 1024 * 1024
+
+var expressionVariables = []string{"status", "body", "headers", "contentLength", "durationMs", "payload", "redirects", "locations"}
+
+// The functions matcher expressions can call, on top of govaluate's operators (i.e. =~ for regexes)
+var expressionFunctions = map[string]govaluate.ExpressionFunction{
+	"contains": func(args ...interface{}) (interface{}, error) {
+		value, substring, err := getExpressionStringArgs("contains", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(value, substring), nil
+	},
+	"icontains": func(args ...interface{}) (interface{}, error) {
+		value, substring, err := getExpressionStringArgs("icontains", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(strings.ToLower(value), strings.ToLower(substring)), nil
+	},
+}
+
+func getExpressionStringArgs(name string, args []interface{}) (string, string, error) {
+	if len(args) != 2 {
+		return "", "", errors.New(fmt.Sprintf("%v() takes 2 arguments, got %v", name, len(args)))
+	}
+	return fmt.Sprint(args[0]), fmt.Sprint(args[1]), nil
+}
+
+// Compile a matcher expression when the config is loaded, so syntax errors and unknown variables fail up front
+func compileMatcherExpression(expression string) (*govaluate.EvaluableExpression, error) {
+	compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expression, expressionFunctions)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("matcher: %v", err))
+	}
+
+	for _, variable := range compiled.Vars() {
+		if !containsString(expressionVariables, variable) {
+			return nil, errors.New(fmt.Sprintf("matcher: unknown variable %v (must be one of %v)", variable, strings.Join(expressionVariables, ", ")))
+		}
+	}
+	return compiled, nil
+}
+
+// Evaluate the expectation's compiled matcher expression against a response, where anything but true (including
+// errors, i.e. comparing a string to a number) doesn't match
+func matchExpression(resp Response, t Task, expectation ExpectedResponse) bool {
+	body := resp.Body
+	if len(body) > expressionMaxBodySize {
+		body = body[:expressionMaxBodySize]
+	}
+
+	payload := t.Payload
+	if len(t.SentPayloads) > 0 {
+		payload = t.SentPayloads[0]
+	}
+
+	// Numbers are floats, as that's what numeric literals in expressions are compared as
+	result, err := expectation.matcherExpression.Evaluate(map[string]interface{}{
+		"status":        float64(resp.StatusCode),
+		"body":          body,
+		"headers":       formatExpressionHeaders(resp.Headers),
+		"contentLength": float64(len(resp.Body)),
+		"durationMs":    float64(resp.Duration.Milliseconds()),
+		"payload":       payload,
+		"redirects":     float64(resp.Redirects),
+		"locations":     strings.Join(resp.RedirectLocations, "\n"),
+	})
+	if err != nil {
+		if opts.Debug {
+			printRed(os.Stderr, "[%v] error evaluating matcher for %v: %v\n", t.RuleName, t.Url, err)
+		}
+		return false
+	}
+
+	matched, ok := result.(bool)
+	if !ok && opts.Debug {
+		printRed(os.Stderr, "[%v] matcher evaluated to %v rather than true or false\n", t.RuleName, result)
+	}
+	return matched
+}
+
+// Headers are passed to expressions as "Name: value" lines, like headerRegex matches them, as expressions can't index
+// maps
+func formatExpressionHeaders(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		for _, value := range headers[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMatchExpression(t *testing.T) {
+	resp := Response{
+		StatusCode:        302,
+		Body:              "<p>Welcome admin</p>",
+		Headers:           http.Header{"Set-Cookie": {"session=abc"}, "Location": {"/admin"}},
+		Redirects:         1,
+		RedirectLocations: []string{"/login", "/admin"},
+	}
+	task := Task{}
+	task.Payload = "' OR 1=1-- -"
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"status == 302", true},
+		{"status >= 200 && status < 300", false},
+		{"contains(body, 'admin') && contentLength > 10", true},
+		{"icontains(body, 'WELCOME')", true},
+		{"contains(body, 'WELCOME')", false},
+		{"headers =~ '(?m)^Set-Cookie: session='", true},
+		{"contains(payload, 'OR 1=1')", true},
+		{"redirects == 1 && contains(locations, '/login')", true},
+		// Expressions that don't evaluate to a bool don't match
+		{"status + 1", false},
+	}
+
+	for _, test := range tests {
+		expression, err := compileMatcherExpression(test.expression)
+		if err != nil {
+			t.Fatalf("compileMatcherExpression(%q) returned %v", test.expression, err)
+		}
+		if got := matchExpression(resp, task, ExpectedResponse{matcherExpression: expression}); got != test.want {
+			t.Errorf("matchExpression(%q) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestCompileMatcherExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"status == ", "matcher:"},
+		{"code == 200", "matcher: unknown variable code"},
+		{"contains(body)", ""},
+	}
+
+	for _, test := range tests {
+		_, err := compileMatcherExpression(test.expression)
+		if test.err == "" {
+			// Wrong argument counts only fail when the expression is evaluated
+			if err != nil {
+				t.Errorf("compileMatcherExpression(%q) = %v, want no error", test.expression, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("compileMatcherExpression(%q) = %v, want an error containing %q", test.expression, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extracted values are cut off at this length, so one that matches far more than intended (i.e. a greedy group over
+// a whole page) doesn't flood the output
+const maxExtractedLength = 200
+
+const (
+	extractorPartBody    = "body"
+	extractorPartHeaders = "headers"
+)
+
+// A named regex whose first capture group is pulled out of a matching response, i.e. a version string or token
+type Extractor struct {
+	Name  string `mapstructure:"name"`
+	Regex string `mapstructure:"regex"`
+	// What the regex is matched against: body (the default), or headers as "Name: value" lines like headerRegex
+	Part string `mapstructure:"part"`
+
+	// Compiled from Regex when the config is loaded
+	regex *regexp.Regexp
+}
+
+type ExtractedValue struct {
+	Name  string
+	Value string
+}
+
+func (v ExtractedValue) String() string {
+	return fmt.Sprintf("%v=%q", v.Name, v.Value)
+}
+
+// Check each extractor has a unique name and a regex with a capture group, and compile it. The extractors are copied,
+// as the config's may be shared when reloading
+func compileExtractors(extractors []Extractor) ([]Extractor, error) {
+	if extractors == nil {
+		return nil, nil
+	}
+
+	compiled := make([]Extractor, 0, len(extractors))
+	names := make(map[string]bool)
+	for i, extractor := range extractors {
+		if extractor.Name == "" {
+			return nil, errors.New(fmt.Sprintf("extractors[%v]: needs a name", i))
+		}
+		if names[extractor.Name] {
+			return nil, errors.New(fmt.Sprintf("extractors[%v]: duplicate name %v", i, extractor.Name))
+		}
+		names[extractor.Name] = true
+
+		switch strings.ToLower(extractor.Part) {
+		case "", extractorPartBody, extractorPartHeaders:
+		default:
+			return nil, errors.New(fmt.Sprintf("extractors.%v: invalid part %v (must be %v or %v)", extractor.Name, extractor.Part, extractorPartBody, extractorPartHeaders))
+		}
+
+		regex, err := regexp.Compile(extractor.Regex)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("extractors.%v: invalid regex %q: %v", extractor.Name, extractor.Regex, err))
+		}
+		if regex.NumSubexp() == 0 {
+			return nil, errors.New(fmt.Sprintf("extractors.%v: regex %q needs a capture group for the value to extract", extractor.Name, extractor.Regex))
+		}
+		extractor.regex = regex
+		compiled = append(compiled, extractor)
+	}
+	return compiled, nil
+}
+
+// Pull each extractor's first capture group from the response. Extractors that don't match (or whose group is empty)
+// are left out rather than failing the match
+func extractValues(resp Response, extractors []Extractor) []ExtractedValue {
+	var values []ExtractedValue
+	headers := ""
+	for _, extractor := range extractors {
+		target := resp.Body
+		if strings.EqualFold(extractor.Part, extractorPartHeaders) {
+			if headers == "" {
+				headers = formatExpressionHeaders(resp.Headers)
+			}
+			target = headers
+		}
+
+		groups := extractor.regex.FindStringSubmatch(target)
+		if len(groups) < 2 || groups[1] == "" {
+			continue
+		}
+
+		value := groups[1]
+		if len(value) > maxExtractedLength {
+			// Cut at the start of a rune, so a multi-byte character isn't split into invalid UTF-8
+			end := maxExtractedLength
+			for end > 0 && !utf8.RuneStart(value[end]) {
+				end -= 1
+			}
+			value = value[:end] + "..."
+		}
+		values = append(values, ExtractedValue{Name: extractor.Name, Value: value})
+	}
+	return values
+}
+
+func formatExtractedValues(values []ExtractedValue) string {
+	formatted := make([]string, 0, len(values))
+	for _, value := range values {
+		formatted = append(formatted, value.String())
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExtractValues(t *testing.T) {
+	// 199 bytes followed by a 3 byte rune, which the length limit would otherwise cut through
+	overLength := strings.Repeat("a", maxExtractedLength-1) + strings.Repeat("€", 10)
+
+	tests := []struct {
+		name       string
+		extractors []Extractor
+		body       string
+		want       string
+	}{
+		{"no match", []Extractor{{Name: "version", Regex: `version ([0-9.]+)`}}, "nothing to see", ""},
+		{"empty group", []Extractor{{Name: "token", Regex: `token="([^"]*)"`}}, `token=""`, ""},
+		{"body", []Extractor{{Name: "version", Regex: `version ([0-9.]+)`}}, "MySQL version 5.7.33", `version="5.7.33"`},
+		{"header part", []Extractor{{Name: "server", Regex: `(?m)^Server: (.+)$`, Part: "headers"}}, "Server: not a header", `server="nginx/1.18.0"`},
+		{"header part isn't case sensitive", []Extractor{{Name: "server", Regex: `(?m)^Server: (.+)$`, Part: "Headers"}}, "", `server="nginx/1.18.0"`},
+		{"over-length value", []Extractor{{Name: "dump", Regex: `dump:(.+)`}}, "dump:" + overLength, `dump="` + strings.Repeat("a", maxExtractedLength-1) + `..."`},
+		{
+			name:       "several extractors, some missing",
+			extractors: []Extractor{{Name: "version", Regex: `version ([0-9.]+)`}, {Name: "missing", Regex: `missing=(\w+)`}, {Name: "path", Regex: `in (/\S+)`}},
+			body:       "version 5.7.33 in /var/www/html/index.php",
+			want:       `version="5.7.33", path="/var/www/html/index.php"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extractors, err := compileExtractors(test.extractors)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := Response{StatusCode: 200, Body: test.body, Headers: http.Header{"Server": {"nginx/1.18.0"}}}
+			values := extractValues(resp, extractors)
+			if got := formatExtractedValues(values); got != test.want {
+				t.Errorf("extractValues = %v, want %v", got, test.want)
+			}
+			for _, value := range values {
+				if !utf8.ValidString(value.Value) {
+					t.Errorf("extracted %v isn't valid UTF-8: %q", value.Name, value.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileExtractorsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		extractors []Extractor
+		err        string
+	}{
+		{"no name", []Extractor{{Regex: `(a)`}}, "extractors[0]: needs a name"},
+		{"duplicate name", []Extractor{{Name: "a", Regex: `(a)`}, {Name: "a", Regex: `(b)`}}, "extractors[1]: duplicate name a"},
+		{"invalid part", []Extractor{{Name: "a", Regex: `(a)`, Part: "cookies"}}, "extractors.a: invalid part cookies"},
+		{"invalid regex", []Extractor{{Name: "a", Regex: `(a`}}, "extractors.a: invalid regex"},
+		{"no capture group", []Extractor{{Name: "a", Regex: `a+`}}, "needs a capture group"},
+	}
+
+	for _, test := range tests {
+		_, err := compileExtractors(test.extractors)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: compileExtractors = %v, want an error containing %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A finding written out in full for notifications (i.e. Slack), so it can be triaged without re-running the scan. It's
+// shared by every kind of finding and notification, so they all read the same
+func formatFindingDetails(match string, result EvaluationResult) string {
+	var details strings.Builder
+	details.WriteString(formatMatchMessage(result.RuleName, result.Severity, match))
+
+	addDetail := func(name string, value interface{}) {
+		details.WriteString(fmt.Sprintf("%-10v %v\n", name+":", value))
+	}
+
+	rule := result.RuleName
+	if result.RuleDescription != "" {
+		rule = fmt.Sprintf("%v (%v)", rule, result.RuleDescription)
+	}
+	addDetail("Rule", rule)
+	if result.Severity != "" {
+		addDetail("Severity", result.Severity)
+	}
+	addDetail("URL", fullyDecode(result.InjectedUrl))
+	if result.Method != "" && result.Method != "GET" {
+		addDetail("Method", result.Method)
+	}
+	if result.Param != "" {
+		addDetail("Parameter", result.Param)
+	}
+	if result.Location != "" && result.Location != result.Param {
+		addDetail("Location", result.Location)
+	}
+	if result.Payload != "" {
+		addDetail("Payload", result.Payload)
+	}
+	// Out-of-band findings come from an interaction rather than a response
+	if result.StatusCode != 0 {
+		addDetail("Status", result.StatusCode)
+		if result.ResponseLength >= 0 {
+			addDetail("Length", fmt.Sprintf("%v bytes", result.ResponseLength))
+		}
+	}
+	if result.Redirect != "" {
+		addDetail("Redirect", result.Redirect)
+	}
+	for _, context := range result.Context {
+		addDetail("Context", context)
+	}
+	for _, value := range result.Extracted {
+		addDetail("Extracted", value)
+	}
+	for _, request := range result.Verification {
+		addDetail("Verified", request)
+	}
+	return details.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Inject into the URL's fragment, which stays in the browser rather than being sent to the server. The whole fragment
+// is replaced, and when it holds parameters (i.e. #a=1&b=2 or #/search?q=1) each value is also injected on its own
+func getInjectedFragmentUrls(u *url.URL, ruleInjections []string, decode bool) []Injection {
+	base := *u
+	base.Fragment = ""
+	baseUrl := base.String()
+
+	// Route style fragments keep everything up to the last ? as-is
+	prefix, rawQuery := "", u.Fragment
+	if index := strings.LastIndex(u.Fragment, "?"); index >= 0 {
+		prefix, rawQuery = u.Fragment[:index+1], u.Fragment[index+1:]
+	}
+
+	var queryStrings url.Values
+	if strings.Contains(rawQuery, "=") {
+		queryStrings, _ = url.ParseQuery(rawQuery)
+	}
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		fragment := expandRequestTemplates(injection, "fragment")
+		replacedUrls = append(replacedUrls, Injection{Url: baseUrl + encodeFragment(fragment, decode), Param: "fragment", Location: "fragment", Payload: injection, SentPayloads: []string{fragment}})
+
+		for _, qs := range getSortedParams(queryStrings) {
+			for index, val := range queryStrings[qs] {
+				payload := expandRequestTemplates(injection, qs)
+				queryStrings[qs][index] = payload
+				injectedQuery, err := encodeQueryStrings(queryStrings, rawQuery, decode)
+
+				// Set back to original qs val to ensure we only update one parameter at a time
+				queryStrings[qs][index] = val
+
+				if err != nil {
+					logParseError("Error decoding parameters: %v\n", err)
+					continue
+				}
+
+				location := fmt.Sprintf("%v in fragment", describeParam(qs, index, len(queryStrings[qs])))
+				injectedUrl := baseUrl + encodeFragment(prefix, decode) + injectedQuery
+				replacedUrls = append(replacedUrls, Injection{Url: injectedUrl, Param: qs, Location: location, Payload: injection, SentPayloads: []string{payload}})
+			}
+		}
+	}
+	return replacedUrls
+}
+
+// The fragment with its leading #, escaped the same way as url.URL.String() unless payloads are sent decoded
+func encodeFragment(fragment string, decode bool) string {
+	if decode {
+		return "#" + fragment
+	}
+	return (&url.URL{Fragment: fragment}).String()
+}
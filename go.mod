@@ -1,8 +1,11 @@
 module github.com/ameenmaali/qsfuzz
 
-go 1.13
+go 1.16
 
 require (
+	github.com/Knetic/govaluate v3.0.0+incompatible
 	github.com/fatih/color v1.9.0
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/spf13/viper v1.6.2
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
 )
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parse hex strings (i.e. 504b0304, "50 4b 03 04" or \x50\x4b\x03\x04) into the bytes they're matched as, once at
+// load time
+func parseHexPatterns(patterns []string, field string) ([][]byte, error) {
+	var decoded [][]byte
+	for _, pattern := range patterns {
+		cleaned := strings.NewReplacer(" ", "", "\t", "", "\\x", "", "0x", "").Replace(pattern)
+		value, err := hex.DecodeString(cleaned)
+		if err != nil || len(value) == 0 {
+			return nil, errors.New(fmt.Sprintf("%v: invalid hex string %q (i.e. 504b0304 or \\x50\\x4b\\x03\\x04)", field, pattern))
+		}
+		decoded = append(decoded, value)
+	}
+	return decoded, nil
+}
+
+func (e ExpectedResponse) countHexChecks() int {
+	checks := 0
+	for _, used := range []bool{e.HexPrefix != nil, e.HexContains != nil} {
+		if used {
+			checks += 1
+		}
+	}
+	return checks
+}
+
+// Match the expectation's hex patterns against the raw body bytes (i.e. magic bytes for files and serialized objects),
+// never the lowercased copy used for ignoreCase, as case mapping would mangle bytes that aren't valid UTF-8. Go's string
+// functions compare bytes, so the body doesn't need copying
+func matchHex(body string, expectation ExpectedResponse) (int, []string) {
+	checksMatched := 0
+	var matchDetails []string
+
+	for i, prefix := range expectation.hexPrefixes {
+		if strings.HasPrefix(body, string(prefix)) {
+			checksMatched += 1
+			matchDetails = append(matchDetails, fmt.Sprintf("hexPrefix %v matched", expectation.HexPrefix[i]))
+			break
+		}
+	}
+	for i, pattern := range expectation.hexPatterns {
+		if offset := strings.Index(body, string(pattern)); offset >= 0 {
+			checksMatched += 1
+			matchDetails = append(matchDetails, fmt.Sprintf("hexContains %v matched at offset %v", expectation.HexContains[i], offset))
+			break
+		}
+	}
+	return checksMatched, matchDetails
+}
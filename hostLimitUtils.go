@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a host's rate stays halved after it responds with 429 Too Many Requests
+const hostCooldown = 60 * time.Second
+
+// How long the requests sent to a host are counted for, to measure the rate a host without a -host-rate is slowed
+// down from when it responds with 429
+const hostRateWindow = 10 * time.Second
+
+// The lowest a host's rate is halved to, so a host that keeps responding with 429 still makes progress
+const minHostRate = 0.1
+
+// Queued requests per worker that are held for -host-concurrency, so the other hosts' requests can be sent while a
+// busy host's wait. Queueing stops once it's full
+const hostQueuePerWorker = 100
+
+// A limit from -host-concurrency or -host-rate, for the hosts matching pattern
+type hostLimit struct {
+	pattern string
+	value   float64
+}
+
+// Set from -host-concurrency and -host-rate
+var hostConcurrencyLimits, hostRateLimits []hostLimit
+
+// Parse a per-host limit flag: a number for every host (i.e. 2), or comma separated host=value pairs with wildcards
+// (i.e. api.example.com=1,*.example.com=5), where a bare number is the limit for the hosts no pair matches
+func parseHostLimits(value string, flagName string, wholeNumbers bool) ([]hostLimit, error) {
+	var limits []hostLimit
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, number := "*", entry
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			pattern, number = strings.ToLower(strings.TrimSpace(entry[:i])), strings.TrimSpace(entry[i+1:])
+		}
+
+		limit, err := strconv.ParseFloat(number, 64)
+		if err != nil || limit <= 0 || (wholeNumbers && limit != float64(int(limit))) {
+			kind := "a number above 0"
+			if wholeNumbers {
+				kind = "a whole number above 0"
+			}
+			return nil, errors.New(fmt.Sprintf("%v flag: invalid limit %q for %v (must be %v)", flagName, number, pattern, kind))
+		}
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, errors.New(fmt.Sprintf("%v flag: invalid host pattern %q", flagName, pattern))
+		}
+		limits = append(limits, hostLimit{pattern: pattern, value: limit})
+	}
+	return limits, nil
+}
+
+// The limit for a host, from the first pair that matches it, or else the default. Hosts without one are only held to
+// the global -w and -rate
+func getHostLimit(limits []hostLimit, host string) (float64, bool) {
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+
+	var fallback *hostLimit
+	for i, limit := range limits {
+		if limit.pattern == "*" {
+			if fallback == nil {
+				fallback = &limits[i]
+			}
+			continue
+		}
+		if matchesHostPattern(hostname, []string{limit.pattern}) || strings.EqualFold(host, limit.pattern) {
+			return limit.value, true
+		}
+	}
+	if fallback != nil {
+		return fallback.value, true
+	}
+	return 0, false
+}
+
+func hasHostLimits() bool {
+	return len(hostConcurrencyLimits) > 0 || len(hostRateLimits) > 0
+}
+
+// The requests queued for one host, how many of them are being sent, and its token bucket for -host-rate
+type hostQueue struct {
+	host        string
+	tasks       []Task
+	active      int
+	concurrency int
+	limiter     *rateLimiter
+	rate        float64
+	// While a host is cooling down after a 429, its limiter runs at a reduced rate until cooldownUntil. Hosts without
+	// a -host-rate only have a limiter while they're cooling down
+	cooldownUntil time.Time
+	slowedAt      time.Time
+	// The requests sent to the host since windowStart, and the rate of the window before it
+	windowStart    time.Time
+	windowSent     int
+	lastWindowRate float64
+}
+
+// Hands out queued requests to the workers for -host-concurrency and -host-rate, taking each host in turn and
+// skipping those already at their concurrency or waiting on their rate, so a host that's limited never holds up the rest
+type hostScheduler struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	hosts   map[string]*hostQueue
+	order   []*hostQueue
+	next    int
+	queued  int
+	maxSize int
+	closed  bool
+}
+
+// Set when there are any per-host limits
+var scheduler *hostScheduler
+
+func newHostScheduler(workers int) *hostScheduler {
+	s := &hostScheduler{hosts: make(map[string]*hostQueue), maxSize: workers * hostQueuePerWorker}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// Requests are grouped by host and port, like URLs are deduplicated
+func getRequestHost(u string) string {
+	if parsed, err := url.Parse(u); err == nil {
+		return getUrlHost(parsed)
+	}
+	return ""
+}
+
+// Must be called with the mutex held
+func (s *hostScheduler) getHostQueue(host string) *hostQueue {
+	if queue, exists := s.hosts[host]; exists {
+		return queue
+	}
+
+	queue := &hostQueue{host: host}
+	if concurrency, limited := getHostLimit(hostConcurrencyLimits, host); limited {
+		queue.concurrency = int(concurrency)
+	}
+	if rate, limited := getHostLimit(hostRateLimits, host); limited {
+		queue.rate = rate
+		queue.limiter = newRateLimiter(rate)
+	}
+	s.hosts[host] = queue
+	s.order = append(s.order, queue)
+	return queue
+}
+
+// Queue a request, waiting while the queue is full
+func (s *hostScheduler) add(t Task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.queued >= s.maxSize {
+		s.cond.Wait()
+	}
+	queue := s.getHostQueue(getRequestHost(t.Url))
+	queue.tasks = append(queue.tasks, t)
+	s.queued += 1
+	s.cond.Broadcast()
+}
+
+// Stop accepting requests, letting the workers finish once the queue is empty
+func (s *hostScheduler) close() {
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+	s.cond.Broadcast()
+}
+
+// Wait for a request that can be sent, returning false once the queue is closed and empty. Hosts with a rate are
+// only picked once they have a token, although it isn't taken until the request is sent, so retries count too
+func (s *hostScheduler) take() (Task, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		var soonest time.Duration
+		for i := 0; i < len(s.order); i++ {
+			queue := s.order[(s.next+i)%len(s.order)]
+			if len(queue.tasks) == 0 || (queue.concurrency > 0 && queue.active >= queue.concurrency) {
+				continue
+			}
+			if queue.limiter != nil {
+				if delay := queue.limiter.getDelay(); delay > 0 {
+					if soonest == 0 || delay < soonest {
+						soonest = delay
+					}
+					continue
+				}
+			}
+
+			task := queue.tasks[0]
+			queue.tasks = queue.tasks[1:]
+			queue.active += 1
+			s.queued -= 1
+			s.next = (s.next + i + 1) % len(s.order)
+			s.cond.Broadcast()
+			return task, true
+		}
+
+		if s.closed && s.queued == 0 {
+			return Task{}, false
+		}
+		// Nothing can be sent until a request finishes, another is queued, or a host's next token is due
+		if soonest > 0 {
+			time.AfterFunc(soonest, s.cond.Broadcast)
+		}
+		s.cond.Wait()
+	}
+}
+
+// Free up the request's host for the next one
+func (s *hostScheduler) done(t Task) {
+	s.mutex.Lock()
+	s.getHostQueue(getRequestHost(t.Url)).active -= 1
+	s.mutex.Unlock()
+	s.cond.Broadcast()
+}
+
+// Wait for a token from the host's -host-rate, called just before each request like the global -rate
+func (s *hostScheduler) waitForHost(u string) {
+	s.mutex.Lock()
+	queue := s.getHostQueue(getRequestHost(u))
+	s.updateCooldown(queue)
+	queue.noteSent()
+	limiter := queue.limiter
+	s.mutex.Unlock()
+
+	if limiter != nil {
+		limiter.wait()
+	}
+}
+
+// Halve the host's rate when it responds with 429 Too Many Requests, for hostCooldown from the last one. Hosts
+// without a -host-rate are halved from the rate they were being sent requests at, or -rate if that's lower. Requests
+// already in flight when it was slowed down only extend the cooldown, so a burst of them doesn't halve it over and over
+func (s *hostScheduler) noteResponse(u string, statusCode int, sentAt time.Time) {
+	if statusCode != 429 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	queue := s.getHostQueue(getRequestHost(u))
+	if queue.limiter == nil {
+		rate := queue.getSentRate()
+		if opts.Rate > 0 && opts.Rate < rate {
+			rate = opts.Rate
+		}
+		if rate < minHostRate {
+			rate = minHostRate
+		}
+		queue.limiter = newRateLimiter(rate)
+	}
+
+	queue.cooldownUntil = time.Now().Add(hostCooldown)
+	if sentAt.Before(queue.slowedAt) {
+		return
+	}
+
+	rate := queue.limiter.getRate() / 2
+	if rate < minHostRate {
+		rate = minHostRate
+	}
+	queue.limiter.setRate(rate)
+	queue.slowedAt = time.Now()
+	if opts.Debug {
+		printRed(os.Stderr, "%v responded with 429, slowing it down to %v requests per second for %v\n", queue.host, rate, hostCooldown)
+	}
+}
+
+// Restore the host's -host-rate once its cooldown is over, or for hosts without one, stop limiting its rate. Must be
+// called with the mutex held
+func (s *hostScheduler) updateCooldown(queue *hostQueue) {
+	if queue.limiter == nil || queue.cooldownUntil.IsZero() || time.Now().Before(queue.cooldownUntil) {
+		return
+	}
+	if queue.rate > 0 {
+		queue.limiter.setRate(queue.rate)
+	} else {
+		queue.limiter = nil
+	}
+	queue.cooldownUntil = time.Time{}
+}
+
+// Count a request sent to the host, starting a new window once hostRateWindow has passed. Must be called with the
+// scheduler's mutex held
+func (queue *hostQueue) noteSent() {
+	now := time.Now()
+	if elapsed := now.Sub(queue.windowStart); elapsed >= hostRateWindow {
+		if !queue.windowStart.IsZero() {
+			queue.lastWindowRate = float64(queue.windowSent) / elapsed.Seconds()
+		}
+		queue.windowStart, queue.windowSent = now, 0
+	}
+	queue.windowSent += 1
+}
+
+// The rate requests have been sent to the host at, over its current window. A window under a second old has too few
+// requests to go by, so the last window's rate is used instead, if there was one
+func (queue *hostQueue) getSentRate() float64 {
+	elapsed := time.Since(queue.windowStart).Seconds()
+	if elapsed < 1 {
+		if queue.lastWindowRate > 0 {
+			return queue.lastWindowRate
+		}
+		elapsed = 1
+	}
+	return float64(queue.windowSent) / elapsed
+}
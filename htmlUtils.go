@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// Only the start of the body is parsed for HTML matchers, as the title and meta tags are in the document's head
+const htmlMaxParseSize = 64 * 1024
+
+// The parts of an HTML document that identify error pages and debug consoles more reliably than its raw markup
+type htmlElements struct {
+	title     string
+	generator string
+}
+
+func (e ExpectedResponse) usesHtmlElements() bool {
+	return e.TitleContains != nil || e.TitleRegex != nil || e.GeneratorContains != nil || e.GeneratorRegex != nil
+}
+
+// Each HTML matcher counts as its own check, like responseContents and bodyRegex
+func (e ExpectedResponse) countHtmlChecks() int {
+	checks := 0
+	for _, used := range []bool{e.TitleContains != nil, e.TitleRegex != nil, e.GeneratorContains != nil, e.GeneratorRegex != nil} {
+		if used {
+			checks += 1
+		}
+	}
+	return checks
+}
+
+// Find the <title> text and <meta name="generator"> content in the start of the body, stopping once the body element
+// starts as neither belongs there
+func parseHtmlElements(body string) htmlElements {
+	if len(body) > htmlMaxParseSize {
+		body = body[:htmlMaxParseSize]
+	}
+
+	var elements htmlElements
+	foundTitle := false
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return elements
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				return elements
+			case atom.Title:
+				// The title's text is the next token, as the tokenizer treats it as raw text
+				if !foundTitle && tokenizer.Next() == html.TextToken {
+					elements.title = strings.TrimSpace(html.UnescapeString(string(tokenizer.Text())))
+					foundTitle = true
+				}
+			case atom.Meta:
+				if strings.EqualFold(getHtmlAttribute(token, "name"), "generator") && elements.generator == "" {
+					elements.generator = strings.TrimSpace(getHtmlAttribute(token, "content"))
+				}
+			}
+		}
+	}
+}
+
+func getHtmlAttribute(token html.Token, name string) string {
+	for _, attribute := range token.Attr {
+		if strings.EqualFold(attribute.Key, name) {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+// Match the expectation's title and generator matchers against the body, which is only parsed here (i.e. when a rule
+// uses them). Returns how many of them matched, with the title or generator that was matched for each
+func matchHtmlElements(body string, expectation ExpectedResponse) (int, []string) {
+	elements := parseHtmlElements(body)
+
+	checksMatched := 0
+	var matchDetails []string
+	matchValue := func(field string, value string, contents []string) {
+		ignoreCase := expectation.ignoresCaseFor(field)
+		compared := value
+		if ignoreCase {
+			compared = strings.ToLower(value)
+		}
+		for _, content := range contents {
+			if ignoreCase {
+				content = strings.ToLower(content)
+			}
+			if strings.Contains(compared, content) {
+				checksMatched += 1
+				matchDetails = append(matchDetails, fmt.Sprintf("%v matched %q", field, truncateSnippet(value)))
+				return
+			}
+		}
+	}
+
+	matchValue("titleContains", elements.title, expectation.TitleContains)
+	matchValue("generatorContains", elements.generator, expectation.GeneratorContains)
+
+	for i, regex := range expectation.titleRegexes {
+		if location := regex.FindStringIndex(elements.title); location != nil {
+			checksMatched += 1
+			matchDetails = append(matchDetails, RegexMatch{Field: "titleRegex", Pattern: expectation.TitleRegex[i], Snippet: truncateSnippet(elements.title[location[0]:location[1]])}.String())
+			break
+		}
+	}
+	for i, regex := range expectation.generatorRegexes {
+		if location := regex.FindStringIndex(elements.generator); location != nil {
+			checksMatched += 1
+			matchDetails = append(matchDetails, RegexMatch{Field: "generatorRegex", Pattern: expectation.GeneratorRegex[i], Snippet: truncateSnippet(elements.generator[location[0]:location[1]])}.String())
+			break
+		}
+	}
+	return checksMatched, matchDetails
+}
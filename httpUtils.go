@@ -1,49 +1,183 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// How much of an unread body is discarded to keep the connection open for reuse
+const skippedBodyDrainSize = 64 * 1024
+
+// Create the clients every worker shares, once at startup. There's one transport configured from the flags, used by
+// the -t timeout client (for Slack, OAuth and oob requests) and the fuzzed request client alike
 func createClient() {
+	maxIdleConns := opts.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = opts.Concurrency
+	}
+
+	dialContext := (&net.Dialer{
+		Timeout:   time.Duration(opts.Timeout) * time.Second,
+		KeepAlive: time.Second,
+	}).DialContext
+	if opts.DnsCache {
+		dialContext = newDnsCache(opts.DnsCacheTtl, opts.DnsCacheSize).wrapDialContext(dialContext)
+	}
+
 	transport := &http.Transport{
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		DisableKeepAlives: true,
-		DialContext: (&net.Dialer{
-			Timeout:   time.Duration(opts.Timeout) * time.Second,
-			KeepAlive: time.Second,
-		}).DialContext,
+		TLSClientConfig: config.tlsConfig,
+		DialContext:     dialContext,
+		Proxy:           getProxyFunc(config.proxyUrl),
+		// Every worker can keep its connection open between requests, even when they're all to the same host, so
+		// large runs don't exhaust ephemeral ports opening a new connection for each request
+		DisableKeepAlives:   maxIdleConns < 0,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		MaxConnsPerHost:     opts.MaxConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
 	}
 
+	config.transport = transport
+
 	httpClient := &http.Client{
 		Transport: transport,
-		Timeout:   time.Duration(opts.Timeout+3) * time.Second,
+		Timeout:   getRequestTimeout(opts.Timeout),
+		// Each rule can choose whether redirects are followed
+		CheckRedirect: checkRedirect,
 	}
 	config.httpClient = httpClient
+
+	// Fuzzed requests share the transport, but each one sets its own deadline from its rule's timeoutSeconds, which
+	// can be longer than -t
+	requestClient := *httpClient
+	requestClient.Timeout = 0
+	config.requestClient = &requestClient
+}
+
+// Requests are given a few seconds on top of the timeout, which (like -t) is also how long connecting can take
+func getRequestTimeout(timeoutSeconds int) time.Duration {
+	return time.Duration(timeoutSeconds+3) * time.Second
+}
+
+// The headers and cookies for a single request, with templates expanded against the URL being assessed. Static
+// headers and cookies are shared between requests as-is rather than copied and re-expanded for each one
+func getRequestHeaders(u *url.URL, ruleData Rule, param string) (map[string]string, string) {
+	cookies := config.Cookies
+	if strings.Contains(cookies, "[[") {
+		cookies = expandHeaderTemplates(cookies, u, param)
+	}
+
+	if len(ruleData.Headers) == 0 && !hasTemplatedValues(config.Headers) {
+		return config.Headers, cookies
+	}
+
+	headers := make(map[string]string, len(config.Headers)+len(ruleData.Headers))
+	for header, value := range config.Headers {
+		headers[header] = expandHeaderTemplates(value, u, param)
+	}
+	for header, value := range ruleData.Headers {
+		headers[header] = expandHeaderTemplates(value, u, param)
+	}
+	return headers, cookies
 }
 
-func sendRequest(u string) (Response, error) {
+// URL based templates are sent as-is in headers, i.e. Referer: [[fullurl]], rather than query escaped like in payloads
+func expandHeaderTemplates(value string, u *url.URL, param string) string {
+	return expandRequestTemplates(expandUrlTemplates(value, u, false), param)
+}
+
+func hasTemplatedValues(values map[string]string) bool {
+	for _, value := range values {
+		if strings.Contains(value, "[[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Send a task's request, retrying it up to its rule's retries (or -retries) with backoff when it fails without a
+// response (i.e. timing out or the connection being reset), or responds with a -retry-on-status code. The last
+// attempt's response or error is returned, so the request is only counted once however many times it was sent
+func sendRequest(t Task) (Response, error) {
+	retries := t.RuleData.getRetries()
+	for attempt := 0; ; attempt++ {
+		response, err := sendRequestOnce(t)
+		if attempt >= retries || !shouldRetry(response, err) {
+			return response, err
+		}
+
+		backoff := getRetryBackoff(attempt + 1)
+		if opts.Debug {
+			reason := fmt.Sprintf("status %v", response.StatusCode)
+			if err != nil {
+				reason = describeRequestError(t.Url, err)
+			}
+			printRed(os.Stderr, "[%v] retrying %v in %v (retry %v of %v): %v\n", t.RuleName, t.Url, backoff.Round(time.Millisecond), attempt+1, retries, reason)
+		}
+		atomic.AddInt64(&retriesSent, 1)
+		time.Sleep(backoff)
+	}
+}
+
+func sendRequestOnce(t Task) (Response, error) {
 	response := Response{}
 
-	request, err := http.NewRequest("GET", u, nil)
+	method := t.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	var requestBody io.Reader
+	if t.Body != "" {
+		requestBody = strings.NewReader(t.Body)
+	}
+
+	waitForRateLimit(t.Url)
+	ctx, cancel := context.WithTimeout(context.Background(), getRequestTimeout(t.RuleData.getTimeoutSeconds()))
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, t.Url, requestBody)
 	if err != nil {
 		return response, err
 	}
 
+	if t.ContentType != "" && !hasHeader(t.Headers, "Content-Type") {
+		request.Header.Set("Content-Type", t.ContentType)
+	}
+
 	request.Header.Add("User-Agent", "User-Agent: Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.100 Safari/537.36")
 
 	// Add headers passed in as arguments
-	for header, value := range config.Headers {
+	for header, value := range t.Headers {
 		request.Header.Add(header, value)
 	}
 
+	// The OAuth2 token replaces any Authorization header from -H or the auth flags, but not one set by the rule itself
+	if oauthClient != nil && !hasHeader(t.RuleData.Headers, "Authorization") {
+		authorization, err := oauthClient.getAuthorizationHeader()
+		if err != nil {
+			return response, err
+		}
+		request.Header.Set("Authorization", authorization)
+	}
+
 	// Add cookies passed in as arguments
-	request.Header.Add("Cookie", config.Cookies)
+	request.Header.Add("Cookie", t.Cookies)
+
+	policy := t.RuleData.getRedirectPolicy()
+	request = withRedirectPolicy(request, policy)
 
-	resp, err := config.httpClient.Do(request)
+	start := time.Now()
+	resp, err := config.requestClient.Do(request)
 
 	if err != nil {
 		return response, err
@@ -55,14 +189,36 @@ func sendRequest(u string) (Response, error) {
 
 	defer resp.Body.Close()
 
+	if scheduler != nil {
+		scheduler.noteResponse(t.Url, resp.StatusCode, start)
+	}
+
+	response.Headers = resp.Header
+	response.StatusCode = resp.StatusCode
+	response.FinalUrl = resp.Request.URL.String()
+	response.Redirects = policy.redirects
+	response.RedirectLocations = policy.locations
+	response.RedirectOutOfScope = policy.outOfScope
+
+	// Rules that only match on the status and headers don't read the body. Small ones are still drained so the
+	// connection can be reused, while anything bigger is dropped with the connection. The same goes for responses of
+	// content types the rule isn't evaluated against
+	if t.RuleData.skipBody || !t.RuleData.matchesContentType(resp.Header) {
+		io.CopyN(ioutil.Discard, resp.Body, skippedBodyDrainSize)
+		response.Duration = time.Since(start)
+		response.BodySkipped = true
+		return response, nil
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return response, err
 	}
 
+	response.Duration = time.Since(start)
+	// Converting to a string keeps the raw bytes as they are (it doesn't validate or replace invalid UTF-8), so binary
+	// bodies can still be matched with hexPrefix and hexContains
 	response.Body = string(body)
-	response.Headers = resp.Header
-	response.StatusCode = resp.StatusCode
 
 	return response, err
 }
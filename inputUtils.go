@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	inputFormatText = "text"
+	inputFormatHar  = "har"
+	inputFormatBurp = "burp"
+)
+
+var inputFormats = []string{inputFormatText, inputFormatHar, inputFormatBurp}
+
+// The parts of an HAR file (i.e. exported from ZAP or a browser's dev tools) needed to get each request's URL
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Url string `json:"url"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// The parts of a Burp Suite XML export (Save items) needed to get each request's URL
+type burpItems struct {
+	Items []struct {
+		Url string `xml:"url"`
+	} `xml:"item"`
+}
+
+func validateInputFormat(format string) error {
+	for _, inputFormat := range inputFormats {
+		if strings.EqualFold(format, inputFormat) {
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("input-format flag must be one of %v, got %v", strings.Join(inputFormats, ", "), format))
+}
+
+// Pass each URL in the input to handleUrl, reading it as a line based list or as a proxy export depending on
+// -input-format. Exports are read in full, as they're a single document rather than a stream of URLs
+func scanInputUrls(input io.Reader, handleUrl func(string)) error {
+	switch strings.ToLower(opts.InputFormat) {
+	case inputFormatHar:
+		var har harFile
+		if err := json.NewDecoder(input).Decode(&har); err != nil {
+			return errors.New(fmt.Sprintf("unable to parse HAR input: %v", err))
+		}
+		for _, entry := range har.Log.Entries {
+			handleUrl(strings.TrimSpace(entry.Request.Url))
+		}
+		return nil
+	case inputFormatBurp:
+		var burp burpItems
+		if err := xml.NewDecoder(input).Decode(&burp); err != nil {
+			return errors.New(fmt.Sprintf("unable to parse Burp XML input: %v", err))
+		}
+		for _, item := range burp.Items {
+			handleUrl(strings.TrimSpace(item.Url))
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		handleUrl(scanner.Text())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const jsonContentType = "application/json"
+
+// Matches array indexes written as [0], so items[0].id and items.0.id select the same field
+var jsonIndexRegex = regexp.MustCompile(`\[(\d+|\*)\]`)
+
+type jsonBodyLeaf struct {
+	path     []interface{}
+	original interface{}
+}
+
+// Inject into each leaf of the rule's JSON body (strings, numbers, booleans and nulls alike), one at a time, leaving the
+// rest of the structure untouched. jsonFields limits which leaves are injected into
+func getInjectedJsonBodies(u *url.URL, template string, ruleInjections []string, fields []string) ([]Injection, error) {
+	// Templates are expanded first, as they can make the JSON unparseable until they are (i.e. {"id": [[random]]})
+	body := expandHeaderTemplates(template, u, "")
+	root, ok := parseJsonValue(body)
+	if !ok {
+		return nil, errors.New("JSON body is not a JSON object or array")
+	}
+
+	var leaves []jsonBodyLeaf
+	collectJsonLeaves(root, nil, &leaves)
+
+	var injectedBodies []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, leaf := range leaves {
+			if !matchesJsonFields(leaf.path, fields) {
+				continue
+			}
+
+			param := getJsonLeafName(leaf.path)
+			payload := expandRequestTemplates(injection, param)
+			root = setJsonValue(root, leaf.path, payload)
+			encoded, err := encodeJsonValue(root)
+			// Set back to the original value to ensure we only update one leaf at a time
+			root = setJsonValue(root, leaf.path, leaf.original)
+			if err != nil {
+				continue
+			}
+
+			injectedBodies = append(injectedBodies, Injection{
+				Url:          u.String(),
+				Method:       "POST",
+				Body:         encoded,
+				ContentType:  jsonContentType,
+				Param:        param,
+				Location:     formatJsonPath(leaf.path) + " in body",
+				Payload:      injection,
+				SentPayloads: []string{payload},
+			})
+		}
+	}
+	return injectedBodies, nil
+}
+
+func collectJsonLeaves(node interface{}, path []interface{}, leaves *[]jsonBodyLeaf) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, key := range getSortedJsonKeys(n) {
+			collectJsonLeaves(n[key], appendJsonPath(path, key), leaves)
+		}
+	case []interface{}:
+		for index, child := range n {
+			collectJsonLeaves(child, appendJsonPath(path, index), leaves)
+		}
+	default:
+		*leaves = append(*leaves, jsonBodyLeaf{path: path, original: n})
+	}
+}
+
+// The closest object key to a leaf, for [[param]]
+func getJsonLeafName(path []interface{}) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if key, ok := path[i].(string); ok {
+			return key
+		}
+	}
+	return "body"
+}
+
+// Split a dotted field path (i.e. user.name, items.*.id or $.items[0].id) into its segments
+func parseJsonField(field string) []string {
+	field = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(field), "$"), ".")
+	field = jsonIndexRegex.ReplaceAllString(field, ".$1")
+	return strings.Split(strings.TrimPrefix(field, "."), ".")
+}
+
+// Whether a leaf is selected by any of the fields, which also select every leaf beneath them (i.e. user selects
+// user.name). * matches any single key or index. Every leaf is selected when there are no fields
+func matchesJsonFields(path []interface{}, fields []string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+
+	for _, field := range fields {
+		segments := parseJsonField(field)
+		if len(segments) > len(path) {
+			continue
+		}
+
+		matched := true
+		for i, segment := range segments {
+			if segment == "*" {
+				continue
+			}
+			switch key := path[i].(type) {
+			case string:
+				matched = key == segment
+			case int:
+				matched = strconv.Itoa(key) == segment
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Catch JSON bodies that can't be fuzzed before any requests are sent. Templated bodies can only be checked once
+// they're expanded for each URL
+func validateJsonBody(ruleData Rule) error {
+	jsonBody := ruleData.getJsonBody()
+	if ruleData.FuzzBody && jsonBody == "" {
+		return errors.New("fuzzBody needs a JSON body from -body, -body-file or jsonBody")
+	}
+	if jsonBody == "" || strings.Contains(jsonBody, "[[") {
+		return nil
+	}
+
+	root, ok := parseJsonValue(jsonBody)
+	if !ok {
+		return errors.New("JSON body is not a JSON object or array")
+	}
+
+	var leaves []jsonBodyLeaf
+	collectJsonLeaves(root, nil, &leaves)
+	for _, field := range ruleData.JsonFields {
+		found := false
+		for _, leaf := range leaves {
+			if matchesJsonFields(leaf.path, []string{field}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("jsonFields %v doesn't match any field in the JSON body", field))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonPathExists   = "exists"
+	jsonPathEquals   = "equals"
+	jsonPathContains = "contains"
+	jsonPathRegex    = "regex"
+)
+
+// Matches a bracketed index, wildcard or quoted key within a path (i.e. [0], [*] or ['error code'])
+var jsonPathBracketRegex = regexp.MustCompile(`\[(\d+|\*|'[^']*'|"[^"]*")\]`)
+
+// A condition on the values at a path in a JSON response body, parsed from a jsonPath entry like
+// "$.error.code": "contains:SQL"
+type jsonPathMatcher struct {
+	path     string
+	segments []string
+	operator string
+	value    string
+	regex    *regexp.Regexp
+}
+
+// Split a path in dot or bracket notation (i.e. $.items[0].id or $['error code']) into its keys and indexes, where *
+// matches any single key or index
+func parseJsonPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	trimmed = jsonPathBracketRegex.ReplaceAllStringFunc(trimmed, func(bracket string) string {
+		segment := strings.Trim(bracket[1:len(bracket)-1], `'"`)
+		// Dots in quoted keys are kept from splitting the path
+		return "." + strings.ReplaceAll(segment, ".", "\x00")
+	})
+
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(trimmed, "."), ".") {
+		if segment == "" || strings.ContainsAny(segment, "[]") {
+			return nil, errors.New(fmt.Sprintf("jsonPath: invalid path %q (i.e. $.error.code, $.items[0].id or $['error code'])", path))
+		}
+		segments = append(segments, strings.ReplaceAll(segment, "\x00", "."))
+	}
+	return segments, nil
+}
+
+// Parse the expectation's jsonPath entries, sorted by path so they're tried (and reported) in a stable order. The
+// config's keys are lowercased when it's loaded, so object keys are compared case-insensitively
+func compileJsonPaths(expectation ExpectedResponse) ([]jsonPathMatcher, error) {
+	paths := make([]string, 0, len(expectation.JsonPath))
+	for path := range expectation.JsonPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ignoreCase := expectation.ignoresCaseFor("jsonPath")
+	var matchers []jsonPathMatcher
+	for _, path := range paths {
+		segments, err := parseJsonPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		condition := expectation.JsonPath[path]
+		operator, value := condition, ""
+		if i := strings.Index(condition, ":"); i >= 0 {
+			operator, value = condition[:i], condition[i+1:]
+		}
+		operator = strings.ToLower(strings.TrimSpace(operator))
+
+		matcher := jsonPathMatcher{path: path, segments: segments, operator: operator, value: value}
+		switch operator {
+		case jsonPathExists:
+			if value != "" {
+				return nil, errors.New(fmt.Sprintf("jsonPath %v: exists doesn't take a value", path))
+			}
+		case jsonPathEquals, jsonPathContains:
+			if ignoreCase {
+				matcher.value = strings.ToLower(value)
+			}
+		case jsonPathRegex:
+			pattern := value
+			if ignoreCase {
+				pattern = "(?i)" + pattern
+			}
+			if matcher.regex, err = regexp.Compile(pattern); err != nil {
+				return nil, errors.New(fmt.Sprintf("jsonPath %v: invalid regex %q: %v", path, value, err))
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("jsonPath %v: invalid condition %q (must be %v, or %v:, %v: or %v: followed by a value)", path, condition, jsonPathExists, jsonPathEquals, jsonPathContains, jsonPathRegex))
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// Whether the response body should be parsed for jsonPath, which it is for JSON content types (including */*+json) or
+// always with forceJson
+func isJsonResponse(resp Response, expectation ExpectedResponse) bool {
+	if expectation.ForceJson {
+		return true
+	}
+	mediaType := getMediaType(resp.Headers.Get("Content-Type"))
+	return mediaType == jsonContentType || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Parse a JSON body, keeping numbers as they were written so they compare as they appear in the response
+func parseJsonBody(body string) (interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, false
+	}
+	return root, true
+}
+
+// Every value at a path, as a path with * can select several. Object keys are matched case-insensitively, preferring
+// an exact match
+func getJsonPathValues(node interface{}, segments []string) []interface{} {
+	if len(segments) == 0 {
+		return []interface{}{node}
+	}
+
+	segment, rest := segments[0], segments[1:]
+	var values []interface{}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for _, key := range getSortedJsonKeys(n) {
+				values = append(values, getJsonPathValues(n[key], rest)...)
+			}
+			return values
+		}
+		if child, exists := n[segment]; exists {
+			return getJsonPathValues(child, rest)
+		}
+		for _, key := range getSortedJsonKeys(n) {
+			if strings.EqualFold(key, segment) {
+				return getJsonPathValues(n[key], rest)
+			}
+		}
+	case []interface{}:
+		if segment == "*" {
+			for _, child := range n {
+				values = append(values, getJsonPathValues(child, rest)...)
+			}
+			return values
+		}
+		if index, err := strconv.Atoi(segment); err == nil && index >= 0 && index < len(n) {
+			return getJsonPathValues(n[index], rest)
+		}
+	}
+	return nil
+}
+
+// Strings are compared as they are, and anything else (numbers, booleans, null, objects and arrays) as its JSON
+func formatJsonPathValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(buffer.String())
+}
+
+func (m jsonPathMatcher) matches(value interface{}, ignoreCase bool) bool {
+	if m.operator == jsonPathExists {
+		return true
+	}
+
+	formatted := formatJsonPathValue(value)
+	switch m.operator {
+	case jsonPathRegex:
+		return m.regex.MatchString(formatted)
+	}
+	if ignoreCase {
+		formatted = strings.ToLower(formatted)
+	}
+	if m.operator == jsonPathEquals {
+		return formatted == m.value
+	}
+	return strings.Contains(formatted, m.value)
+}
+
+// Find the first jsonPath condition that holds for the response, returning the path and the value it matched. Bodies
+// that aren't valid JSON never match, rather than failing the request
+func matchJsonPaths(resp Response, expectation ExpectedResponse) (string, bool) {
+	if len(expectation.jsonPaths) == 0 || !isJsonResponse(resp, expectation) {
+		return "", false
+	}
+
+	root, ok := parseJsonBody(resp.Body)
+	if !ok {
+		return "", false
+	}
+
+	ignoreCase := expectation.ignoresCaseFor("jsonPath")
+	for _, matcher := range expectation.jsonPaths {
+		for _, value := range getJsonPathValues(root, matcher.segments) {
+			if matcher.matches(value, ignoreCase) {
+				return fmt.Sprintf("jsonPath %v %v %q", matcher.path, matcher.operator, truncateSnippet(formatJsonPathValue(value))), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A rewritten parameter value, along with where the payload was placed within it
+type ValueVariant struct {
+	Value string
+	Path  string
+	// The expanded payload within Value
+	Payload string
+}
+
+type jsonLeaf struct {
+	path  []interface{}
+	value string
+}
+
+// Parse the value as JSON and inject the payload into each string leaf, one at a time, leaving the rest of the
+// structure untouched. Returns false if the value isn't JSON (or has no string leaves to inject into)
+func getInjectedJsonValues(value string, param string, injection string, appendPayload bool) ([]ValueVariant, bool) {
+	root, ok := parseJsonValue(value)
+	if !ok {
+		return nil, false
+	}
+
+	var leaves []jsonLeaf
+	collectJsonStringLeaves(root, nil, &leaves)
+	if len(leaves) == 0 {
+		return nil, false
+	}
+
+	var variants []ValueVariant
+	for _, leaf := range leaves {
+		payload := expandRequestTemplates(injection, param)
+		injected := payload
+		if appendPayload {
+			injected = leaf.value + injected
+		}
+
+		root = setJsonValue(root, leaf.path, injected)
+		encoded, err := encodeJsonValue(root)
+		// Set back to the original value to ensure we only update one leaf at a time
+		root = setJsonValue(root, leaf.path, leaf.value)
+		if err != nil {
+			continue
+		}
+
+		variants = append(variants, ValueVariant{Value: encoded, Path: formatJsonPath(leaf.path), Payload: payload})
+	}
+	return variants, true
+}
+
+func parseJsonValue(value string) (interface{}, bool) {
+	trimmed := strings.TrimSpace(value)
+	// Only objects and arrays are treated as JSON, otherwise plain numbers and words would qualify
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	// Keep numbers as they were written rather than converting them to floats
+	decoder.UseNumber()
+
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, false
+	}
+	return root, true
+}
+
+func encodeJsonValue(root interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Payloads such as <script> should be sent as-is, not as \u003cscript\u003e
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(root); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func collectJsonStringLeaves(node interface{}, path []interface{}, leaves *[]jsonLeaf) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, key := range getSortedJsonKeys(n) {
+			collectJsonStringLeaves(n[key], appendJsonPath(path, key), leaves)
+		}
+	case []interface{}:
+		for index, child := range n {
+			collectJsonStringLeaves(child, appendJsonPath(path, index), leaves)
+		}
+	case string:
+		*leaves = append(*leaves, jsonLeaf{path: path, value: n})
+	}
+}
+
+// Set the value at the given path, returning the (possibly replaced) root
+func setJsonValue(root interface{}, path []interface{}, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	node := root
+	for _, segment := range path[:len(path)-1] {
+		switch key := segment.(type) {
+		case string:
+			node = node.(map[string]interface{})[key]
+		case int:
+			node = node.([]interface{})[key]
+		}
+	}
+
+	switch key := path[len(path)-1].(type) {
+	case string:
+		node.(map[string]interface{})[key] = value
+	case int:
+		node.([]interface{})[key] = value
+	}
+	return root
+}
+
+func appendJsonPath(path []interface{}, segment interface{}) []interface{} {
+	newPath := make([]interface{}, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, segment)
+}
+
+func formatJsonPath(path []interface{}) string {
+	var formatted strings.Builder
+	formatted.WriteString("$")
+	for _, segment := range path {
+		switch key := segment.(type) {
+		case string:
+			formatted.WriteString("." + key)
+		case int:
+			formatted.WriteString(fmt.Sprintf("[%d]", key))
+		}
+	}
+	return formatted.String()
+}
+
+func getSortedJsonKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
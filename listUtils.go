@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// A loaded rule as printed by -list-rules
+type RuleListing struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"`
+	Tags        []string   `json:"tags"`
+	Payloads    int        `json:"payloads"`
+	Matchers    [][]string `json:"matchers"`
+}
+
+func getRuleListings(rules map[string]Rule) []RuleListing {
+	listings := make([]RuleListing, 0, len(rules))
+	for _, rule := range getSortedRuleNames(rules) {
+		ruleData := rules[rule]
+
+		matchers := [][]string{}
+		for _, expectation := range ruleData.getExpectations() {
+			if expectation.hasMatchers() {
+				matchers = append(matchers, getMatcherNames(expectation))
+			}
+		}
+
+		tags := ruleData.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		listings = append(listings, RuleListing{
+			Name:        rule,
+			Description: ruleData.Description,
+			Severity:    ruleData.Severity,
+			Tags:        tags,
+			Payloads:    len(ruleData.Injections),
+			Matchers:    matchers,
+		})
+	}
+	return listings
+}
+
+// The expectation fields a group uses, with "(any)" appended when only one of them needs to match
+func getMatcherNames(expectation ExpectedResponse) []string {
+	var names []string
+	addName := func(name string, used bool) {
+		if used {
+			names = append(names, name)
+		}
+	}
+
+	addName("responseContents", expectation.Contents != nil)
+	addName("responseCodes", expectation.Codes != nil)
+	addName("responseHeaders", expectation.Headers != nil)
+	addName("minLength", expectation.MinLength > 0)
+	addName("maxLength", expectation.MaxLength > 0)
+	addName("bodyRegex", expectation.BodyRegex != nil)
+	addName("headerRegex", expectation.HeaderRegex != nil)
+	addName("headerMatchers", expectation.HeaderMatchers != nil)
+	addName("reflected", expectation.Reflected != "")
+	addName("matcher", expectation.Matcher != "")
+	addName("titleContains", expectation.TitleContains != nil)
+	addName("titleRegex", expectation.TitleRegex != nil)
+	addName("generatorContains", expectation.GeneratorContains != nil)
+	addName("generatorRegex", expectation.GeneratorRegex != nil)
+	addName("jsonPath", expectation.JsonPath != nil)
+	addName("hexPrefix", expectation.HexPrefix != nil)
+	addName("hexContains", expectation.HexContains != nil)
+	addName("minDelaySeconds", expectation.MinDelaySeconds > 0)
+	addName("lengthDeltaGreaterThan", expectation.LengthDeltaGreaterThan != "")
+	addName("words", expectation.Words != nil)
+	addName("lines", expectation.Lines != nil)
+	addName("wordsDeltaFromBaseline", expectation.WordsDeltaFromBaseline != nil)
+	addName("linesDeltaFromBaseline", expectation.LinesDeltaFromBaseline != nil)
+	addName("notContains", expectation.NotContains != nil)
+	addName("notRegex", expectation.NotRegex != nil)
+
+	if strings.EqualFold(expectation.MatchersCondition, matchersConditionOr) && len(names) > 1 {
+		names = append(names, "(any)")
+	}
+	return names
+}
+
+// Print the rules as a table for -list-rules (or as JSON with -json), where alternative expectation groups are
+// separated by "or"
+func listRules(rules map[string]Rule) error {
+	listings := getRuleListings(rules)
+
+	if opts.Json {
+		encoded, err := json.MarshalIndent(listings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSEVERITY\tTAGS\tPAYLOADS\tMATCHERS\tDESCRIPTION")
+	for _, listing := range listings {
+		groups := make([]string, 0, len(listing.Matchers))
+		for _, matchers := range listing.Matchers {
+			groups = append(groups, strings.Join(matchers, ", "))
+		}
+
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\n", listing.Name, valueOrDash(listing.Severity), valueOrDash(strings.Join(listing.Tags, ", ")), listing.Payloads, valueOrDash(strings.Join(groups, " or ")), listing.Description)
+	}
+	return writer.Flush()
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -1,153 +1,767 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"github.com/Knetic/govaluate"
 	"github.com/fatih/color"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Exit codes follow grep's convention when -fail-on-match is set: 1 when there are matches, 2 for errors
+const (
+	exitCodeMatch = 1
+	exitCodeError = 2
+)
+
 type CliOptions struct {
-	ConfigFile    string
-	Cookies       string
-	Headers       string
-	Debug         bool
-	Concurrency   int
-	DecodedParams bool
-	SilentMode    bool
-	Timeout       int
-	ToSlack       bool
+	ConfigFiles     multiFlag
+	Cookies         string
+	Headers         string
+	Debug           bool
+	Concurrency     int
+	DecodedParams   bool
+	SilentMode      bool
+	Timeout         int
+	ToSlack         bool
+	XmlBodyFile     string
+	Sample          int
+	Seed            int64
+	NormalizeArrays bool
+	NoDedup         bool
+	FailOnMatch     bool
+	QuietErrors     bool
+	ExplainSkips    bool
+	Oob             bool
+	OobWait         int
+	Vars            multiFlag
+	Watch           bool
+	IncludeHosts    string
+	ExcludeHosts    string
+	ScopeRegex      string
+	ExcludeRegex    string
+	StrictTemplates bool
+	UrlFile         string
+	GzipInput       bool
+	Summary         bool
+	Combine         int
+	MaxCombos       int
+	PreserveOrder   bool
+	MinSeverity     string
+	OnlySeverity    string
+	FuzzFragment    bool
+	Tags            string
+	ExcludeTags     string
+	Rules           string
+	ExcludeRules    string
+	Body            string
+	BodyFile        string
+	Methods         string
+	AllowOverride   bool
+	BasicAuth       string
+	Bearer          string
+	InputFormat     string
+	Sarif           string
+	MaxIdleConns    int
+	MaxConnsPerHost int
+	DnsCache        bool
+	DnsCacheTtl     int
+	DnsCacheSize    int
+	StopOnFirst     bool
+	FpFile          string
+	ShowSuppressed  bool
+	GenerateFp      string
+	Proxy           string
+	Insecure        bool
+	CaCert          string
+	Count           bool
+	Rate            float64
+	Checkpoint      string
+	Context         int
+	HostConcurrency string
+	HostRate        string
+	Retries         int
+	RetryBackoff    float64
+	RetryOnStatus   string
+	NoColor         bool
+	FollowRedirects bool
+	MaxRedirects    int
+	RedirectScope   string
+
+	// The builtin rules, used when -c isn't given
+	MergeBuiltin      bool
+	ListBuiltin       bool
+	DumpBuiltinConfig string
+
+	// Check the config for problems and exit, or with Lenient, only warn about them
+	Validate bool
+	Lenient  bool
+	// Print the loaded rules and exit, as a table or as JSON
+	ListRules bool
+	Json      bool
 }
 
 type Config struct {
 	Rules      map[string]Rule   `mapstructure:"rules"`
-	Slack      map[string]string `mapstructure:"slack"`
+	Slack      *SlackConfig      `mapstructure:"slack"`
+	Oob        map[string]string `mapstructure:"oob"`
+	Vars       map[string]string `mapstructure:"vars"`
+	Include    []string          `mapstructure:"include"`
 	Cookies    string
 	Headers    map[string]string
+	XmlBody    string
 	httpClient *http.Client
+	// Used for fuzzed requests, without a client-wide timeout so rules can set their own
+	requestClient *http.Client
+	// Parsed from -x, which takes precedence over the proxy environment variables
+	proxyUrl *url.URL
+	// How certificates are verified, from -k and -ca-cert
+	tlsConfig *tls.Config
+	// The single transport behind both clients, so every request shares one connection pool, and anything about how
+	// connections are made (i.e. proxies or TLS) is configured in one place
+	transport *http.Transport
+	// Sent with every request that doesn't have a body of its own, from -body or -body-file
+	Body            string
+	BodyContentType string
+	// How many rules were in the config file, before any were dropped by the selection flags
+	totalRules int
+	// The config file each rule came from, for resolving its wordlists and the summary
+	ruleSources map[string]string
+	// Added around every rule's injections (i.e. a canary or tracking marker), so rules don't each have to repeat it
+	InjectionPrefix string `mapstructure:"injectionPrefix"`
+	InjectionSuffix string `mapstructure:"injectionSuffix"`
+	// Client credentials for fetching (and refreshing) an OAuth2 access token sent with every request
+	OAuth map[string]string `mapstructure:"oauth"`
+	// Builtin rules (by name or tag, i.e. [xss, sqli]) merged in under the config file's own rules
+	Builtin []string `mapstructure:"builtin"`
 }
 
 type Rule struct {
 	Description string           `mapstructure:"description"`
 	Injections  []string         `mapstructure:"injections"`
 	Expectation ExpectedResponse `mapstructure:"expectation"`
+	XmlBody     string           `mapstructure:"xmlBody"`
+	RawXml      bool             `mapstructure:"rawXml"`
+	Sample      int              `mapstructure:"sample"`
+	ArrayParams []string         `mapstructure:"arrayParams"`
+	// Inject into the decoded form of encoded parameter values (i.e. base64)
+	ValueCodec     string `mapstructure:"valueCodec"`
+	ValueCodecMode string `mapstructure:"valueCodecMode"`
+	ValueCodecJson bool   `mapstructure:"valueCodecJson"`
+	NestedUrl      string `mapstructure:"nestedUrl"`
+	// Inject into each string leaf of JSON parameter values rather than replacing the whole value
+	JsonValues bool `mapstructure:"jsonValues"`
+	// Inject into each value of query strings nested within parameter values (i.e. data=a%3D1%26b%3D2)
+	NestedQuery bool `mapstructure:"nestedQuery"`
+	// Sent on top of (and overriding) the global headers for this rule's requests
+	Headers map[string]string `mapstructure:"headers"`
+	// Send payloads un-encoded, overriding -decode for this rule
+	Decode *bool `mapstructure:"decode"`
+	// Used to select which rules run with -tags and -exclude-tags
+	Tags []string `mapstructure:"tags"`
+	// One of info, low, medium, high or critical
+	Severity string `mapstructure:"severity"`
+	// A command (i.e. a headless browser script) run for each match, which is only reported if the command exits 0
+	VerifyCommand string `mapstructure:"verifyCommand"`
+	VerifyTimeout int    `mapstructure:"verifyTimeout"`
+	// Follow-up requests sent for each match, all of which need to pass for it to be reported
+	Verify []VerifyStep `mapstructure:"verify"`
+	// Send payloads exactly as written, without parsing and re-encoding the query string
+	Raw bool `mapstructure:"raw"`
+	// Inject into each leaf of a JSON body instead of the query string, either this template or (with fuzzBody) the
+	// -body content
+	JsonBody string `mapstructure:"jsonBody"`
+	FuzzBody bool   `mapstructure:"fuzzBody"`
+	// Dotted paths of the JSON body fields to inject into (i.e. user.name or items.*.id), rather than every leaf
+	JsonFields []string `mapstructure:"jsonFields"`
+	// Alternative groups of expectations, where the rule matches if expectation or any one of these does
+	Expectations []ExpectedResponse `mapstructure:"expectations"`
+	// Whether redirects are followed (the default) so the final response is evaluated, and how many of them
+	FollowRedirects *bool `mapstructure:"followRedirects"`
+	MaxRedirects    int   `mapstructure:"maxRedirects"`
+	// Override -t for this rule's requests (i.e. longer for time based payloads), and retry those that fail
+	TimeoutSeconds *int `mapstructure:"timeoutSeconds"`
+	Retries        *int `mapstructure:"retries"`
+	// Named regexes whose first capture group is pulled out of matching responses and included in findings
+	Extractors []Extractor `mapstructure:"extractors"`
+	// Media types (or wildcard patterns) of the responses the rule is evaluated against, i.e. application/json
+	ContentTypes []string `mapstructure:"contentType"`
+	// Only inject into parameters whose names match this regex (i.e. ^(url|redirect|next)$), rather than every one
+	ParamRegex string `mapstructure:"paramRegex"`
+	paramRegex *regexp.Regexp
+	// Set when loading for rules that only match on the status and headers, whose response bodies aren't read
+	skipBody bool
 }
 
 type ExpectedResponse struct {
-	Contents []string          `mapstructure:"responseContents"`
-	Codes    []int             `mapstructure:"responseCodes"`
-	Headers  map[string]string `mapstructure:"responseHeaders"`
+	// How the categories below combine, with "and" (the default) requiring all of them and "or" any one of them
+	MatchersCondition string `mapstructure:"matchersCondition"`
+
+	Contents []string `mapstructure:"responseContents"`
+	// Codes (i.e. 302) or inclusive ranges (i.e. "500-599")
+	Codes   []string          `mapstructure:"responseCodes"`
+	Headers map[string]string `mapstructure:"responseHeaders"`
+	// Bounds on the response body length, in bytes
+	MinLength int `mapstructure:"minLength"`
+	MaxLength int `mapstructure:"maxLength"`
+	// Content and header matching is case-insensitive unless this is explicitly set to false
+	IgnoreCase *bool `mapstructure:"ignoreCase"`
+	// Overrides ignoreCase for individual matchers, keyed by matcher name (i.e. responseContents: false)
+	CaseInsensitive map[string]bool `mapstructure:"caseInsensitive"`
+	// Which part of the response content matchers look at: body (the default), headers or all, and overrides of it for
+	// individual matchers, keyed by matcher name (i.e. responseContents: all)
+	Part  string            `mapstructure:"part"`
+	Parts map[string]string `mapstructure:"parts"`
+	// How many times a responseContents value or bodyRegex needs to be found, and overrides of it for either matcher
+	MinCount  int            `mapstructure:"minCount"`
+	MinCounts map[string]int `mapstructure:"minCounts"`
+	// Regexes matched against the response body, and against each response header as "Name: value"
+	BodyRegex   []string `mapstructure:"bodyRegex"`
+	HeaderRegex []string `mapstructure:"headerRegex"`
+	// Conditions on individual response headers, keyed by the (case-insensitive) header name
+	HeaderMatchers map[string]HeaderMatcher `mapstructure:"headerMatchers"`
+	// Look for the exact payloads sent in the request in the response body: raw, encoded (HTML or URL encoded) or any
+	Reflected string `mapstructure:"reflected"`
+	// A boolean expression over the response (i.e. status == 200 && contains(body, "uid=")), compiled when loading
+	Matcher           string `mapstructure:"matcher"`
+	matcherExpression *govaluate.EvaluableExpression
+	// Matched against the HTML <title> and <meta name="generator"> content, parsed from the body only when used
+	TitleContains     []string `mapstructure:"titleContains"`
+	TitleRegex        []string `mapstructure:"titleRegex"`
+	GeneratorContains []string `mapstructure:"generatorContains"`
+	GeneratorRegex    []string `mapstructure:"generatorRegex"`
+	titleRegexes      []*regexp.Regexp
+	generatorRegexes  []*regexp.Regexp
+	// Hex encoded bytes (i.e. 504b0304 for a ZIP) to look for at the start of the raw body, or anywhere in it
+	HexPrefix   []string `mapstructure:"hexPrefix"`
+	HexContains []string `mapstructure:"hexContains"`
+	hexPrefixes [][]byte
+	hexPatterns [][]byte
+	// Conditions on values in a JSON body, keyed by path (i.e. "$.error.code": "contains:SQL"), which is only parsed
+	// for JSON content types unless forceJson is set
+	JsonPath  map[string]string `mapstructure:"jsonPath"`
+	ForceJson bool              `mapstructure:"forceJson"`
+	jsonPaths []jsonPathMatcher
+
+	// Negative matchers, which rule out a response if any of their values are found in the body
+	NotContains []string `mapstructure:"notContains"`
+	NotRegex    []string `mapstructure:"notRegex"`
+
+	// Compiled from BodyRegex, HeaderRegex and NotRegex when the config is loaded
+	bodyRegexes   []*regexp.Regexp
+	headerRegexes []*regexp.Regexp
+	notRegexes    []*regexp.Regexp
+	// Time based matching, for the response taking at least this many seconds (longer than an unfuzzed baseline
+	// request if relativeToBaseline is set), confirmed by resending the request delayConfirmations times
+	MinDelaySeconds    float64 `mapstructure:"minDelaySeconds"`
+	RelativeToBaseline bool    `mapstructure:"relativeToBaseline"`
+	DelayConfirmations int     `mapstructure:"delayConfirmations"`
+	// Match when the body length differs from an unfuzzed baseline request by more than this many bytes (i.e. 500),
+	// or by more than a percentage of the baseline's length (i.e. 20%)
+	LengthDeltaGreaterThan string `mapstructure:"lengthDeltaGreaterThan"`
+	// Conditions (gt, lt and eq) on the body's word and line counts, and on how much they differ from the baseline's
+	Words                  *CountCondition `mapstructure:"words"`
+	Lines                  *CountCondition `mapstructure:"lines"`
+	WordsDeltaFromBaseline *CountCondition `mapstructure:"wordsDeltaFromBaseline"`
+	LinesDeltaFromBaseline *CountCondition `mapstructure:"linesDeltaFromBaseline"`
+
+	// Parsed from Codes and LengthDeltaGreaterThan when the config is loaded
+	codeRanges         []codeRange
+	lengthDelta        float64
+	lengthDeltaPercent bool
+}
+
+// Conditions on a single response header, all of which need to hold for one of its values
+type HeaderMatcher struct {
+	Contains string `mapstructure:"contains"`
+	Regex    string `mapstructure:"regex"`
+	// Whether the header must be present (true) or absent (false)
+	Exists *bool `mapstructure:"exists"`
+
+	// Compiled from Regex when the config is loaded
+	regex *regexp.Regexp
 }
 
 type Response struct {
 	StatusCode int
 	Body       string
 	Headers    http.Header
+	// How long the request took, including reading the body
+	Duration time.Duration
+	// Where the request ended up, and how many redirects it followed to get there
+	FinalUrl  string
+	Redirects int
+	// The Location of each redirect response in order, and whether the last was outside -redirect-scope
+	RedirectLocations  []string
+	RedirectOutOfScope bool
+	// Set for rules that don't match on the body, which isn't read
+	BodySkipped bool
 }
 
 type RuleEvaluation struct {
 	ChecksMatched  int
 	SuccessMessage string
 	Successful     bool
+	Severity       string
+	// The SuccessMessage without the rule name and severity
+	Match string
+	// The finding, with everything notifications need to describe it
+	Result EvaluationResult
 }
 
 type EvaluationResult struct {
 	RuleName        string
 	RuleDescription string
 	InjectedUrl     string
+	Location        string
+	StatusCode      int
+	Severity        string
+	// What was sent, and how long the response body was (-1 if it wasn't read), for notifications
+	Method         string
+	Param          string
+	Payload        string
+	ResponseLength int
+	// Where an unfollowed redirect pointed, or the final URL and hop count of followed ones
+	Redirect string
+	// The match message, without the rule name and severity
+	Match string
+	// Values pulled out of the response by the rule's extractors
+	Extracted []ExtractedValue
+	// The follow-up requests the rule's verify steps sent, and how each one turned out
+	Verification []string
+	// The response text around what was matched, with -context
+	Context []MatchContext
+}
+
+type Injection struct {
+	Url         string
+	Method      string
+	Body        string
+	ContentType string
+	Param       string
+	Location    string
+	// The rule's injection as it was placed in the request, with URL based templates expanded
+	Payload string
+	// Each value the payload was sent as, with request templates (i.e. [[random]]) expanded too, so responses can be
+	// checked for the exact values this request reflected
+	SentPayloads []string
 }
 
 type Task struct {
-	InjectedUrl string
-	RuleData    Rule
-	RuleName    string
+	Injection
+	RuleData Rule
+	RuleName string
+	// The URL the injection was generated from
+	TargetUrl string
+	// Headers and cookies with any templates expanded for this request
+	Headers map[string]string
+	Cookies string
+	// The follow-up requests for the rule's verify steps, in order, which stop at the first step that couldn't be built
+	VerifyTasks []Task
 }
 
-var failedRequestsSent int
-var successfulRequestsSent int
+var parseErrors int
+
+// How many requests were sent, and how many of them failed. Incremented by the workers, so they're only accessed
+// atomically
+var failedRequestsSent int64
+var successfulRequestsSent int64
+
 var config Config
 var opts CliOptions
+
+// Parsed from -include-hosts and -exclude-hosts
+var includeHosts, excludeHosts []string
 var evaluationResults []EvaluationResult
+var evaluationResultsMutex sync.Mutex
+
+// Only used while generating requests, which happens on one goroutine as it isn't safe for concurrent use
+var random *rand.Rand
 
 var printGreen = color.New(color.FgGreen).PrintfFunc()
 var printRed = color.New(color.FgRed).FprintfFunc()
 var printCyan = color.New(color.FgCyan).FprintfFunc()
 var startTime = time.Now()
 
-func runEvaluation(resp Response, ruleData Rule, injectedUrl string, ruleName string) RuleEvaluation {
+func runEvaluation(resp Response, t Task) RuleEvaluation {
+	ruleData := t.RuleData
+	injectedUrl := t.Url
+
+	var ruleEvaluation RuleEvaluation
+
+	// Responses of other content types aren't evaluated at all (and their bodies weren't read)
+	if !ruleData.matchesContentType(resp.Headers) {
+		if opts.Debug {
+			printRed(os.Stderr, "[%v] skipping %v, as its content type %q isn't one of %v\n", t.RuleName, injectedUrl, getMediaType(resp.Headers.Get("Content-Type")), strings.Join(ruleData.ContentTypes, ", "))
+		}
+		return ruleEvaluation
+	}
+
+	// Each group of expectations is evaluated on its own, and the first one to match is reported
+	var matchDetails []string
+	var matchedExpectation ExpectedResponse
+	for _, expectation := range ruleData.getExpectations() {
+		checksMatched, details, successful := evaluateExpectation(resp, t, expectation)
+		if checksMatched > ruleEvaluation.ChecksMatched {
+			ruleEvaluation.ChecksMatched = checksMatched
+		}
+		if successful {
+			ruleEvaluation.Successful = true
+			matchDetails = details
+			matchedExpectation = expectation
+			break
+		}
+	}
+
+	// Matches below -min-severity are still evaluated, but never reported
+	if ruleEvaluation.Successful && !meetsMinSeverity(ruleData.Severity) {
+		if opts.Debug {
+			printRed(os.Stderr, "[%v] match for %v is below -min-severity, not reporting it\n", t.RuleName, injectedUrl)
+		}
+		ruleEvaluation.Successful = false
+	}
+
+	// Verify steps are sent before the verify command, which is the slowest part of a match
+	var verification []string
+	if ruleEvaluation.Successful && ruleData.Verify != nil {
+		verification, ruleEvaluation.Successful = verifyWithRequests(t)
+	}
+
+	// The verify command is the slowest part of a match, so it's only run once everything else has passed
+	if ruleEvaluation.Successful && ruleData.VerifyCommand != "" && !verifyMatch(t) {
+		ruleEvaluation.Successful = false
+	}
+
+	if ruleEvaluation.Successful {
+		u := describeRequest(t.Method, fullyDecode(injectedUrl))
+
+		if t.Location != "" {
+			u = fmt.Sprintf("%v (injected at %v)", u, t.Location)
+		}
+
+		if matchDetails != nil {
+			u = fmt.Sprintf("%v (%v)", u, strings.Join(matchDetails, ", "))
+		}
+
+		redirect := describeRedirects(resp)
+		if redirect != "" {
+			u = fmt.Sprintf("%v [status %v, %v]", u, resp.StatusCode, redirect)
+		} else {
+			u = fmt.Sprintf("%v [status %v]", u, resp.StatusCode)
+		}
+
+		responseLength := len(resp.Body)
+		if resp.BodySkipped {
+			responseLength = -1
+		}
+
+		contexts := getMatchContexts(resp, matchedExpectation)
+		for _, context := range contexts {
+			u = fmt.Sprintf("%v [context %v]", u, context)
+		}
+
+		extracted := extractValues(resp, ruleData.Extractors)
+		if extracted != nil {
+			u = fmt.Sprintf("%v [extracted %v]", u, formatExtractedValues(extracted))
+		}
+
+		if verification != nil {
+			u = fmt.Sprintf("%v [verified with %v follow-up requests]", u, len(verification))
+		}
+
+		ruleEvaluation.Severity = ruleData.Severity
+		ruleEvaluation.Match = fmt.Sprintf("successful match for %v\n", u)
+		ruleEvaluation.SuccessMessage = formatMatchMessage(t.RuleName, ruleData.Severity, ruleEvaluation.Match)
+		ruleEvaluation.Result = EvaluationResult{
+			RuleName:        t.RuleName,
+			RuleDescription: ruleData.Description,
+			InjectedUrl:     injectedUrl,
+			Location:        t.Location,
+			StatusCode:      resp.StatusCode,
+			Severity:        ruleData.Severity,
+			Method:          t.Method,
+			Param:           t.Param,
+			Payload:         t.Payload,
+			ResponseLength:  responseLength,
+			Redirect:        redirect,
+			Match:           ruleEvaluation.Match,
+			Extracted:       extracted,
+			Verification:    verification,
+			Context:         contexts,
+		}
+
+		// Known false positives from -fp-file are dropped before anything is printed or sent
+		if isSuppressed(ruleEvaluation.Result) {
+			ruleEvaluation.Successful = false
+			return ruleEvaluation
+		}
+
+		evaluationResultsMutex.Lock()
+		evaluationResults = append(evaluationResults, ruleEvaluation.Result)
+		evaluationResultsMutex.Unlock()
+	}
+
+	return ruleEvaluation
+}
+
+// Evaluate a single group of expectations, returning how many of its checks matched, details of what was matched and
+// whether that's enough for the group to be successful
+func evaluateExpectation(resp Response, t Task, expectation ExpectedResponse) (int, []string, bool) {
 	headersExpected := false
 	bodyExpected := false
 	codeExpected := false
+	lengthExpected := false
 
 	numOfChecks := 0
+	checksMatched := 0
 
-	var ruleEvaluation RuleEvaluation
-
-	if ruleData.Expectation.Headers != nil {
+	if expectation.Headers != nil {
 		headersExpected = true
 		numOfChecks += 1
 	}
 
-	if ruleData.Expectation.Contents != nil {
+	if expectation.Contents != nil {
 		bodyExpected = true
 		numOfChecks += 1
 	}
 
-	if ruleData.Expectation.Codes != nil {
+	if expectation.Codes != nil {
 		codeExpected = true
 		numOfChecks += 1
 	}
 
+	if expectation.MinLength > 0 || expectation.MaxLength > 0 {
+		lengthExpected = true
+		numOfChecks += 1
+	}
+
+	if expectation.BodyRegex != nil {
+		numOfChecks += 1
+	}
+
+	if expectation.HeaderRegex != nil {
+		numOfChecks += 1
+	}
+
+	if expectation.HeaderMatchers != nil {
+		numOfChecks += 1
+	}
+
+	if expectation.Reflected != "" {
+		numOfChecks += 1
+	}
+
+	if expectation.Matcher != "" {
+		numOfChecks += 1
+	}
+
+	if expectation.JsonPath != nil {
+		numOfChecks += 1
+	}
+
+	numOfChecks += expectation.countHtmlChecks()
+	numOfChecks += expectation.countHexChecks()
+
+	// Checks against a baseline or that need to resend the request are deferred until everything else has matched
+	countChecks, deferredChecks := expectation.countCountChecks()
+	numOfChecks += countChecks + deferredChecks
+
+	lengthDeltaExpected := expectation.LengthDeltaGreaterThan != ""
+	if lengthDeltaExpected {
+		numOfChecks += 1
+		deferredChecks += 1
+	}
+
+	delayExpected := expectation.MinDelaySeconds > 0
+	if delayExpected {
+		numOfChecks += 1
+		deferredChecks += 1
+	}
+
+	// Each part of the response is built (and lowercased) at most once, and only if a matcher compares against it
+	texts := make(map[string]string)
+	getText := func(matcher string, lower bool) string {
+		part := expectation.partFor(matcher)
+		key := fmt.Sprintf("%v:%v", part, lower)
+		if text, exists := texts[key]; exists {
+			return text
+		}
+		text := getResponsePart(resp, part)
+		if lower {
+			text = strings.ToLower(text)
+		}
+		texts[key] = text
+		return text
+	}
+	getBody := func(matcher string) string {
+		return getText(matcher, expectation.ignoresCaseFor(matcher))
+	}
+
+	// Negative matchers rule out the response entirely, so there's no need to evaluate anything else
+	if matchesNegatives(getText, expectation) {
+		return checksMatched, nil, false
+	}
+
+	// Regex, header, count and delay matches are kept, so findings show what was actually matched
+	var matchDetails []string
+
+	// Each category of expectation counts as a single check, so only 1 value within a category needs to match
 	if bodyExpected {
-		for _, content := range ruleData.Expectation.Contents {
-			if strings.Contains(strings.ToLower(resp.Body), strings.ToLower(content)) {
-				ruleEvaluation.ChecksMatched += 1
+		body := getBody("responseContents")
+		minCount := expectation.minCountFor("responseContents")
+		for _, content := range expectation.Contents {
+			if expectation.ignoresCaseFor("responseContents") {
+				content = strings.ToLower(content)
+			}
+			if minCount <= 1 {
+				if strings.Contains(body, content) {
+					checksMatched += 1
+					break
+				}
+				continue
+			}
+			if count := countSubstring(body, content); count >= minCount {
+				checksMatched += 1
+				matchDetails = append(matchDetails, fmt.Sprintf("responseContents %q found %v", content, describeMatchCount(count)))
+				break
 			}
 		}
 	}
 
 	if codeExpected {
-		for _, code := range ruleData.Expectation.Codes {
-			if code == resp.StatusCode {
-				ruleEvaluation.ChecksMatched += 1
+		for _, codes := range expectation.codeRanges {
+			if codes.contains(resp.StatusCode) {
+				checksMatched += 1
+				break
 			}
 		}
 	}
 
 	if headersExpected {
-		for header, value := range ruleData.Expectation.Headers {
-			if strings.Contains(strings.ToLower(resp.Headers.Get(header)), strings.ToLower(value)) {
-				ruleEvaluation.ChecksMatched += 1
+		for header, value := range expectation.Headers {
+			headerValue := resp.Headers.Get(header)
+			if expectation.ignoresCaseFor("responseHeaders") {
+				headerValue = strings.ToLower(headerValue)
+				value = strings.ToLower(value)
+			}
+			if strings.Contains(headerValue, value) {
+				checksMatched += 1
+				break
 			}
 		}
 	}
 
-	if ruleEvaluation.ChecksMatched > 0 && ruleEvaluation.ChecksMatched >= numOfChecks {
-		ruleEvaluation.Successful = true
-		u, err := url.QueryUnescape(injectedUrl)
-		if err != nil {
-			u = injectedUrl
+	if lengthExpected {
+		bodyLength := len(resp.Body)
+		if bodyLength >= expectation.MinLength && (expectation.MaxLength == 0 || bodyLength <= expectation.MaxLength) {
+			checksMatched += 1
 		}
-		// Sprintf expects format string and arguments so URL encoded values will show up as (MISSING)
-		// when printed. This will URL decode until fully decoded when printing for readability
-		for strings.Contains(u, "%") {
-			decodedUrl, err := url.QueryUnescape(u)
-			if err != nil {
-				break
+	}
+
+	if match, ok := matchBodyRegexes(getText("bodyRegex", false), expectation.BodyRegex, expectation.bodyRegexes, expectation.minCountFor("bodyRegex")); ok {
+		checksMatched += 1
+		matchDetails = append(matchDetails, match.String())
+	}
+
+	if match, ok := matchHeaderRegexes(resp.Headers, expectation.HeaderRegex, expectation.headerRegexes); ok {
+		checksMatched += 1
+		matchDetails = append(matchDetails, match.String())
+	}
+
+	if detail, ok := matchHeaderMatchers(resp.Headers, expectation.HeaderMatchers, expectation.ignoresCaseFor("headerMatchers")); ok {
+		checksMatched += 1
+		matchDetails = append(matchDetails, detail)
+	}
+
+	if expectation.Reflected != "" {
+		if detail, ok := matchReflected(getBody("reflected"), t.SentPayloads, expectation.Reflected, expectation.ignoresCaseFor("reflected")); ok {
+			checksMatched += 1
+			matchDetails = append(matchDetails, detail)
+		}
+	}
+
+	if expectation.matcherExpression != nil && matchExpression(resp, t, expectation) {
+		checksMatched += 1
+		matchDetails = append(matchDetails, fmt.Sprintf("matcher %q", expectation.Matcher))
+	}
+
+	if detail, ok := matchJsonPaths(resp, expectation); ok {
+		checksMatched += 1
+		matchDetails = append(matchDetails, detail)
+	}
+
+	if expectation.usesHtmlElements() {
+		htmlChecks, htmlDetails := matchHtmlElements(resp.Body, expectation)
+		checksMatched += htmlChecks
+		matchDetails = append(matchDetails, htmlDetails...)
+	}
+
+	hexMatched, hexDetails := matchHex(resp.Body, expectation)
+	checksMatched += hexMatched
+	matchDetails = append(matchDetails, hexDetails...)
+
+	countsMatched, countDetails := matchCounts(resp.Body, expectation)
+	checksMatched += countsMatched
+	matchDetails = append(matchDetails, countDetails...)
+
+	// Deferred checks are only made when they can still change the outcome, so when everything else has matched (or
+	// nothing has, with matchersCondition: or)
+	matchesAny := expectation.matchesAny()
+	needsCheck := func(remainingChecks int) bool {
+		if matchesAny {
+			return checksMatched == 0
+		}
+		return checksMatched == numOfChecks-remainingChecks
+	}
+
+	if lengthDeltaExpected && needsCheck(deferredChecks) {
+		if detail, ok := matchesLengthDelta(resp, t, expectation); ok {
+			checksMatched += 1
+			matchDetails = append(matchDetails, detail)
+		}
+		deferredChecks -= 1
+	}
+
+	for _, delta := range []struct {
+		field     string
+		condition *CountCondition
+	}{{"words", expectation.WordsDeltaFromBaseline}, {"lines", expectation.LinesDeltaFromBaseline}} {
+		if delta.condition == nil {
+			continue
+		}
+		if needsCheck(deferredChecks) {
+			if detail, ok := matchesCountDelta(resp, t, delta.field, *delta.condition); ok {
+				checksMatched += 1
+				matchDetails = append(matchDetails, detail)
 			}
-			u = decodedUrl
 		}
+		deferredChecks -= 1
+	}
 
-		ruleEvaluation.SuccessMessage = fmt.Sprintf("[%s] successful match for %v\n", ruleName, u)
-		evaluationResults = append(evaluationResults, EvaluationResult{RuleName: ruleName, RuleDescription: ruleData.Description, InjectedUrl: injectedUrl})
+	// The delay is checked last, as it may need extra requests to confirm
+	if delayExpected && needsCheck(1) {
+		if detail, ok := matchesDelay(resp, t, expectation); ok {
+			checksMatched += 1
+			matchDetails = append(matchDetails, detail)
+		}
 	}
 
-	return ruleEvaluation
+	if checksMatched == 0 {
+		return checksMatched, nil, false
+	}
+	if matchesAny || checksMatched >= numOfChecks {
+		return checksMatched, matchDetails, true
+	}
+	return checksMatched, nil, false
 }
 
 func main() {
@@ -155,25 +769,106 @@ func main() {
 	if err != nil {
 		fmt.Println(err)
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitCodeError)
 	}
 
-	if err := loadConfig(opts.ConfigFile); err != nil {
+	if opts.ListBuiltin {
+		if err := listBuiltinRules(); err != nil {
+			fmt.Println("Failed listing builtin rules:", err)
+			os.Exit(exitCodeError)
+		}
+		return
+	}
+
+	if opts.DumpBuiltinConfig != "" {
+		if err := dumpBuiltinConfig(opts.DumpBuiltinConfig); err != nil {
+			fmt.Println("Failed writing builtin config:", err)
+			os.Exit(exitCodeError)
+		}
+		return
+	}
+
+	if err := loadConfig(opts.ConfigFiles); err != nil {
 		fmt.Println("Failed loading config:", err)
-		os.Exit(1)
+		os.Exit(exitCodeError)
+	}
+
+	if opts.Validate {
+		fmt.Printf("Config is valid, with %v rules\n", len(config.Rules))
+		return
+	}
+
+	if opts.ListRules {
+		if err := listRules(config.Rules); err != nil {
+			fmt.Println("Failed listing rules:", err)
+			os.Exit(exitCodeError)
+		}
+		return
 	}
 
 	urls, err := getUrlsFromFile()
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitCodeError)
 	}
 
 	// Create HTTP Transport and Client after parsing flags
 	createClient()
 
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	random = rand.New(rand.NewSource(seed))
+
+	if opts.Count {
+		if err := printRequestCounts(urls, config.Rules); err != nil {
+			fmt.Println("Failed counting requests:", err)
+			os.Exit(exitCodeError)
+		}
+		return
+	}
+
+	if err := createOobClient(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitCodeError)
+	}
+
+	if err := createOAuthClient(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitCodeError)
+	}
+
+	if opts.Checkpoint != "" {
+		if scanCheckpoint, err = loadCheckpoint(opts.Checkpoint); err != nil {
+			fmt.Println(err)
+			os.Exit(exitCodeError)
+		}
+		scanCheckpoint.saveOnInterrupt()
+	}
+
+	if opts.Debug {
+		for _, rule := range getSortedRuleNames(config.Rules) {
+			ruleData := config.Rules[rule]
+			printRed(os.Stderr, "[%v] requests time out after %vs with %v retries\n", rule, ruleData.getTimeoutSeconds(), ruleData.getRetries())
+		}
+	}
+
 	if !opts.SilentMode {
-		printCyan(os.Stderr, "There are %v unique URL/Query String combinations. Time to inject each query string, 1 at a time!\n", len(urls))
+		if len(opts.ConfigFiles) == 0 {
+			printCyan(os.Stderr, "No config file given with -c, so using the builtin rules (see -list-builtin)\n")
+		}
+		if len(config.Rules) < config.totalRules {
+			printCyan(os.Stderr, "Selected %v of %v rules\n", len(config.Rules), config.totalRules)
+		}
+		if scanCheckpoint != nil && scanCheckpoint.resumed > 0 {
+			printCyan(os.Stderr, "Resuming from %v, skipping %v completed URL/rule/parameter combinations\n", opts.Checkpoint, scanCheckpoint.resumed)
+		}
+		if opts.NoDedup {
+			printCyan(os.Stderr, "There are %v URLs (deduplication disabled). Time to inject each query string, 1 at a time!\n", len(urls))
+		} else {
+			printCyan(os.Stderr, "There are %v unique URL/Query String combinations. Time to inject each query string, 1 at a time!\n", len(urls))
+		}
 	}
 
 	tasks := make(chan Task)
@@ -185,6 +880,13 @@ func main() {
 	for i := 0; i < opts.Concurrency; i++ {
 		wg.Add(1)
 		go func() {
+			// With per-host limits, the scheduler picks which host's request is sent next
+			if scheduler != nil {
+				for task, ok := scheduler.take(); ok; task, ok = scheduler.take() {
+					task.execute()
+					scheduler.done(task)
+				}
+			}
 			for task := range tasks {
 				task.execute()
 			}
@@ -192,67 +894,232 @@ func main() {
 		}()
 	}
 
+	if opts.Watch {
+		if err := watchConfig(opts.ConfigFiles); err != nil {
+			fmt.Println("Failed watching config:", err)
+			os.Exit(exitCodeError)
+		}
+	}
+
 	for _, u := range urls {
-		for rule, ruleData := range config.Rules {
+		// Rules are fetched for each URL so any reloaded with -watch are picked up, while requests already
+		// queued finish with the rules they were generated from
+		rules := getRules()
+
+		// Iterate rules in a stable order so runs with the same -seed generate identical request sequences
+		for _, rule := range getSortedRuleNames(rules) {
+			// With -stop-on-first, the rest of the rules aren't generated once one has matched the URL
+			if hasUrlMatched(u) {
+				break
+			}
+
+			ruleData := rules[rule]
 			fullUrl, err := url.Parse(u)
 			// If URL can't be parsed, ignore and move on
 			if err != nil {
-				if opts.Debug {
-					printRed(os.Stderr, "[%v] error parsing URL or query parameters for\n", rule)
-				}
+				logParseError("[%v] error parsing URL or query parameters for %v\n", rule, u)
 				continue
 			}
 
-			injectedUrls, err := getInjectedUrls(fullUrl, ruleData.Injections)
+			injections, err := getRuleInjections(fullUrl, ruleData)
 			if err != nil {
-				if opts.Debug {
-					printRed(os.Stderr, "[%v] error parsing URL or query parameters for\n", rule)
-				}
+				logParseError("[%v] error generating injections for %v: %v\n", rule, u, err)
 				continue
 			}
-			if injectedUrls == nil {
+
+			// Fragments never reach the server, so their URLs are printed for a browser to verify rather than sent
+			if opts.FuzzFragment {
+				for _, injection := range injections {
+					fmt.Println(injection.Url)
+				}
 				continue
 			}
 
-			for _, injectedUrl := range injectedUrls {
-				tasks <- Task{RuleName: rule, RuleData: ruleData, InjectedUrl: injectedUrl}
+			ruleTasks := make([]Task, 0, len(injections))
+			for _, injection := range injections {
+				injection = addRequestBody(injection, fullUrl)
+				headers, cookies := getRequestHeaders(fullUrl, ruleData, injection.Param)
+				for _, methodInjection := range getMethodInjections(injection) {
+					ruleTasks = append(ruleTasks, Task{Injection: methodInjection, RuleName: rule, RuleData: ruleData, TargetUrl: u, Headers: headers, Cookies: cookies})
+				}
+			}
+
+			// Work items a previous run finished are skipped when resuming from -checkpoint
+			if scanCheckpoint != nil {
+				ruleTasks = scanCheckpoint.addTasks(ruleTasks)
+			}
+
+			if ruleData.Verify != nil {
+				addVerifyTasks(ruleTasks, fullUrl)
+			}
+
+			// Any [[oob]] values need to be mapped back to their request before it's sent, in case of a quick callback
+			if oobClient != nil {
+				oobClient.correlate(u, rule, ruleData, ruleTasks)
+			}
+
+			for _, task := range ruleTasks {
+				if scheduler != nil {
+					scheduler.add(task)
+				} else {
+					tasks <- task
+				}
 			}
 		}
 	}
 
+	if scheduler != nil {
+		scheduler.close()
+	}
 	close(tasks)
 	wg.Wait()
 
+	if scanCheckpoint != nil {
+		scanCheckpoint.save()
+	}
+
+	if oobClient != nil {
+		oobClient.close(time.Duration(opts.OobWait) * time.Second)
+	}
+
+	if opts.QuietErrors && parseErrors > 0 {
+		printRed(os.Stderr, "Skipped %v malformed URLs or query strings\n", parseErrors)
+	}
+
 	secondsElapsed := time.Since(startTime).Seconds()
-	printCyan(os.Stderr, "Evaluations complete! %v successful requests sent (%v failed): %v requests per second\n", successfulRequestsSent, failedRequestsSent, int(float64(successfulRequestsSent)/secondsElapsed))
+	successful, failed := atomic.LoadInt64(&successfulRequestsSent), atomic.LoadInt64(&failedRequestsSent)
+	printCyan(os.Stderr, "Evaluations complete! %v successful requests sent (%v failed): %v\n", successful, failed, describeRequestRate(successful+failed, secondsElapsed))
+
+	if !opts.SilentMode || opts.Summary {
+		printSummary(len(urls))
+	}
+
+	if opts.Sarif != "" {
+		if err := writeSarifReport(opts.Sarif, getRules()); err != nil {
+			fmt.Println("Failed writing SARIF report:", err)
+			os.Exit(exitCodeError)
+		}
+	}
+
+	if opts.GenerateFp != "" {
+		if err := writeSuppressionFile(opts.GenerateFp); err != nil {
+			fmt.Println("Failed writing false positive file:", err)
+			os.Exit(exitCodeError)
+		}
+	}
+
+	if opts.FailOnMatch && len(evaluationResults) > 0 {
+		os.Exit(exitCodeMatch)
+	}
+}
+
+func (e ExpectedResponse) ignoresCase() bool {
+	return e.IgnoreCase == nil || *e.IgnoreCase
+}
+
+// Whether a single matcher ignores case, which is ignoreCase unless caseInsensitive overrides it for that matcher.
+// Names are compared case-insensitively, as the config loader lowercases map keys
+func (e ExpectedResponse) ignoresCaseFor(matcher string) bool {
+	for name, ignoreCase := range e.CaseInsensitive {
+		if strings.EqualFold(name, matcher) {
+			return ignoreCase
+		}
+	}
+	return e.ignoresCase()
+}
+
+// Whether any one category matching is enough, rather than every category having to match
+func (e ExpectedResponse) matchesAny() bool {
+	return strings.EqualFold(e.MatchersCondition, matchersConditionOr)
+}
+
+// The rule's expectation followed by any alternative groups in expectations, only one of which needs to match
+func (r Rule) getExpectations() []ExpectedResponse {
+	return append([]ExpectedResponse{r.Expectation}, r.Expectations...)
+}
+
+// A rule's decode setting takes precedence over the -decode flag
+func (r Rule) decodesParams() bool {
+	if r.Decode != nil {
+		return *r.Decode
+	}
+	return opts.DecodedParams
+}
+
+// The XML body template defined on the rule takes precedence over the one passed in with -xml-body
+func (r Rule) getXmlBody() string {
+	if r.XmlBody != "" {
+		return r.XmlBody
+	}
+	return config.XmlBody
+}
+
+// The JSON body template defined on the rule takes precedence over the -body content, which is only fuzzed with fuzzBody
+func (r Rule) getJsonBody() string {
+	if r.JsonBody != "" {
+		return r.JsonBody
+	}
+	if r.FuzzBody {
+		return config.Body
+	}
+	return ""
+}
+
+// The sample size defined on the rule takes precedence over the one passed in with -sample
+func (r Rule) getSampleSize() int {
+	if r.Sample > 0 {
+		return r.Sample
+	}
+	return opts.Sample
+}
+
+// The timeout defined on the rule takes precedence over the one passed in with -t, and may be longer or shorter
+func (r Rule) getTimeoutSeconds() int {
+	if r.TimeoutSeconds != nil {
+		return *r.TimeoutSeconds
+	}
+	return opts.Timeout
 }
 
 func (t Task) execute() {
-	resp, err := sendRequest(t.InjectedUrl)
+	if scanCheckpoint != nil {
+		defer scanCheckpoint.finishTask(t)
+	}
+
+	if shouldSkipTask(t) {
+		return
+	}
+
+	resp, err := sendRequest(t)
 	if err != nil {
-		failedRequestsSent += 1
+		atomic.AddInt64(&failedRequestsSent, 1)
+		if isTlsVerificationError(err) {
+			atomic.AddInt64(&tlsVerificationFailures, 1)
+		}
 		if opts.Debug {
-			printRed(os.Stderr, "error sending HTTP request to %v: %v\n", t.InjectedUrl, err)
+			printRed(os.Stderr, "error sending HTTP request to %v (timeout %vs): %v\n", t.Url, t.RuleData.getTimeoutSeconds(), describeRequestError(t.Url, err))
 		}
 		return
 	}
 
-	successfulRequestsSent += 1
+	successful := atomic.AddInt64(&successfulRequestsSent, 1)
 
-	// Send an update every 1,000 requests
+	// Send an update every 1,000 requests (or more often with -rate)
 	if !opts.SilentMode {
-		totalRequestsSent := successfulRequestsSent + failedRequestsSent
-		if totalRequestsSent%1000 == 0 {
+		failed := atomic.LoadInt64(&failedRequestsSent)
+		totalRequestsSent := successful + failed
+		if totalRequestsSent%int64(getProgressInterval()) == 0 {
 			secondsElapsed := time.Since(startTime).Seconds()
-			fmt.Fprintf(os.Stderr, "%v requests sent (%v failed): %v requests per second\n", totalRequestsSent, failedRequestsSent, int(float64(successfulRequestsSent)/secondsElapsed))
+			fmt.Fprintf(os.Stderr, "%v requests sent (%v failed): %v\n", totalRequestsSent, failed, describeRequestRate(totalRequestsSent, secondsElapsed))
 		}
 	}
 
-	ruleEvaluation := runEvaluation(resp, t.RuleData, t.InjectedUrl, t.RuleName)
+	ruleEvaluation := runEvaluation(resp, t)
 	if ruleEvaluation.Successful {
-		printGreen(ruleEvaluation.SuccessMessage)
+		markUrlMatched(t.TargetUrl)
+		printMatch(t.RuleName, ruleEvaluation.Severity, ruleEvaluation.Match)
 		if opts.ToSlack {
-			err = sendSlackMessage(ruleEvaluation.SuccessMessage)
+			err = sendSlackMessage(formatFindingDetails(ruleEvaluation.Match, ruleEvaluation.Result), ruleEvaluation.Severity, t.RuleData.Tags)
 			if err != nil && opts.Debug {
 				printRed(os.Stderr, "error sending Slack message: %v\n", err)
 			}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func TestIgnoresCaseFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation ExpectedResponse
+		matcher     string
+		want        bool
+	}{
+		{"default", ExpectedResponse{}, "responseContents", true},
+		{"ignoreCase false", ExpectedResponse{IgnoreCase: boolPointer(false)}, "responseContents", false},
+		{"override to sensitive", ExpectedResponse{CaseInsensitive: map[string]bool{"responseContents": false}}, "responseContents", false},
+		{"override to insensitive", ExpectedResponse{IgnoreCase: boolPointer(false), CaseInsensitive: map[string]bool{"bodyRegex": true}}, "bodyRegex", true},
+		{"other matchers keep the default", ExpectedResponse{CaseInsensitive: map[string]bool{"responseContents": false}}, "bodyRegex", true},
+		{"other matchers keep ignoreCase", ExpectedResponse{IgnoreCase: boolPointer(false), CaseInsensitive: map[string]bool{"bodyRegex": true}}, "responseContents", false},
+		// The config loader lowercases map keys
+		{"lowercased override", ExpectedResponse{CaseInsensitive: map[string]bool{"responsecontents": false}}, "responseContents", false},
+	}
+
+	for _, test := range tests {
+		if got := test.expectation.ignoresCaseFor(test.matcher); got != test.want {
+			t.Errorf("%v: ignoresCaseFor(%q) = %v, want %v", test.name, test.matcher, got, test.want)
+		}
+	}
+}
+
+// A rule mixing case-sensitive and case-insensitive matchers only matches when each one does, with its own setting
+func TestEvaluateExpectationMixedCase(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation ExpectedResponse
+		body        string
+		headers     http.Header
+		want        bool
+	}{
+		{
+			name:        "sensitive contents and insensitive regex both match",
+			expectation: ExpectedResponse{Contents: []string{"SQL syntax"}, BodyRegex: []string{"mysql_fetch"}, CaseInsensitive: map[string]bool{"responsecontents": false}},
+			body:        "You have an error in your SQL syntax near MYSQL_FETCH_ARRAY",
+			want:        true,
+		},
+		{
+			name:        "sensitive contents in the wrong case",
+			expectation: ExpectedResponse{Contents: []string{"SQL syntax"}, BodyRegex: []string{"mysql_fetch"}, CaseInsensitive: map[string]bool{"responsecontents": false}},
+			body:        "you have an error in your sql syntax near mysql_fetch_array",
+			want:        false,
+		},
+		{
+			name:        "insensitive regex missing",
+			expectation: ExpectedResponse{Contents: []string{"SQL syntax"}, BodyRegex: []string{"mysql_fetch"}, CaseInsensitive: map[string]bool{"responsecontents": false}},
+			body:        "You have an error in your SQL syntax",
+			want:        false,
+		},
+		{
+			name:        "insensitive headers with ignoreCase false",
+			expectation: ExpectedResponse{Contents: []string{"Warning"}, Headers: map[string]string{"X-Powered-By": "php"}, IgnoreCase: boolPointer(false), CaseInsensitive: map[string]bool{"responseheaders": true}},
+			body:        "Warning: include(): Failed opening",
+			headers:     http.Header{"X-Powered-By": {"PHP/7.4"}},
+			want:        true,
+		},
+		{
+			name:        "sensitive contents with ignoreCase false",
+			expectation: ExpectedResponse{Contents: []string{"Warning"}, Headers: map[string]string{"X-Powered-By": "php"}, IgnoreCase: boolPointer(false), CaseInsensitive: map[string]bool{"responseheaders": true}},
+			body:        "warning: include(): Failed opening",
+			headers:     http.Header{"X-Powered-By": {"PHP/7.4"}},
+			want:        false,
+		},
+		{
+			name:        "sensitive regex next to insensitive contents",
+			expectation: ExpectedResponse{Contents: []string{"root:x:0:0"}, BodyRegex: []string{"[A-Z]+_SECRET"}, CaseInsensitive: map[string]bool{"bodyregex": false}},
+			body:        "ROOT:X:0:0 and api_secret",
+			want:        false,
+		},
+		{
+			name:        "sensitive regex and insensitive contents both match",
+			expectation: ExpectedResponse{Contents: []string{"root:x:0:0"}, BodyRegex: []string{"[A-Z]+_SECRET"}, CaseInsensitive: map[string]bool{"bodyregex": false}},
+			body:        "ROOT:X:0:0 and API_SECRET",
+			want:        true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectation, err := loadExpectation(test.expectation, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers := test.headers
+			if headers == nil {
+				headers = http.Header{}
+			}
+
+			resp := Response{StatusCode: 200, Body: test.body, Headers: headers}
+			if _, _, matched := evaluateExpectation(resp, Task{}, expectation); matched != test.want {
+				t.Errorf("evaluateExpectation matched = %v, want %v", matched, test.want)
+			}
+		})
+	}
+}
+
+// Each category counts as a single check however many of its values match, so matching several of one category
+// can't make up for another category that didn't match
+func TestEvaluateExpectationCountsCategoriesOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		expectation ExpectedResponse
+		status      int
+		checks      int
+		want        bool
+	}{
+		{"every content matches but the code doesn't", ExpectedResponse{Contents: []string{"error", "syntax"}, Codes: []string{"200"}}, 500, 1, false},
+		{"every content and the code match", ExpectedResponse{Contents: []string{"error", "syntax"}, Codes: []string{"500"}}, 500, 2, true},
+		{"every header matches but the content doesn't", ExpectedResponse{Contents: []string{"missing"}, Headers: map[string]string{"Server": "nginx", "X-Debug": "on"}}, 200, 1, false},
+		{"overlapping code ranges", ExpectedResponse{Codes: []string{"500-599", "500"}, Contents: []string{"missing"}}, 500, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectation, err := loadExpectation(test.expectation, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := Response{StatusCode: test.status, Body: "SQL syntax error", Headers: http.Header{"Server": {"nginx"}, "X-Debug": {"on"}}}
+			checks, _, matched := evaluateExpectation(resp, Task{}, expectation)
+			if checks != test.checks || matched != test.want {
+				t.Errorf("evaluateExpectation = %v checks, matched %v, want %v checks, matched %v", checks, matched, test.checks, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Matched snippets are cut down to this many characters in findings
+const maxSnippetLength = 100
+
+const (
+	matchersConditionAnd = "and"
+	matchersConditionOr  = "or"
+)
+
+// An inclusive range of response codes, which is a single code when min and max are the same
+type codeRange struct {
+	min int
+	max int
+}
+
+func (r codeRange) contains(code int) bool {
+	return code >= r.min && code <= r.max
+}
+
+// Parse responseCodes such as 302 and "500-599" once at load time, rejecting anything outside of 100-599
+func parseCodeRanges(codes []string) ([]codeRange, error) {
+	var ranges []codeRange
+	for _, code := range codes {
+		bounds := strings.SplitN(strings.TrimSpace(code), "-", 2)
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		max := min
+		if err == nil && len(bounds) == 2 {
+			max, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+
+		if err != nil || min < 100 || max > 599 || min > max {
+			return nil, errors.New(fmt.Sprintf("invalid responseCodes value %q (must be a code or range between 100 and 599, i.e. 302 or \"500-599\")", code))
+		}
+		ranges = append(ranges, codeRange{min: min, max: max})
+	}
+	return ranges, nil
+}
+
+// Validate and compile everything an expectation group needs before any requests are sent, for a rule whose requests
+// time out after timeoutSeconds
+func loadExpectation(expectation ExpectedResponse, timeoutSeconds int) (ExpectedResponse, error) {
+	switch strings.ToLower(expectation.MatchersCondition) {
+	case "", matchersConditionAnd, matchersConditionOr:
+	default:
+		return expectation, errors.New(fmt.Sprintf("invalid matchersCondition %q (must be %q or %q)", expectation.MatchersCondition, matchersConditionAnd, matchersConditionOr))
+	}
+
+	if err := validateNegativeMatchers(expectation); err != nil {
+		return expectation, err
+	}
+
+	if err := validateReflected(expectation.Reflected); err != nil {
+		return expectation, err
+	}
+
+	if err := validateCaseInsensitive(expectation.CaseInsensitive); err != nil {
+		return expectation, err
+	}
+
+	if err := validateParts(expectation); err != nil {
+		return expectation, err
+	}
+
+	if err := validateMinCounts(expectation); err != nil {
+		return expectation, err
+	}
+
+	if expectation.Matcher != "" {
+		matcherExpression, err := compileMatcherExpression(expectation.Matcher)
+		if err != nil {
+			return expectation, err
+		}
+		expectation.matcherExpression = matcherExpression
+	}
+
+	if err := validateDelayExpectation(expectation, timeoutSeconds); err != nil {
+		return expectation, err
+	}
+
+	if err := validateCountConditions(expectation); err != nil {
+		return expectation, err
+	}
+
+	return compileExpectationRegexes(expectation)
+}
+
+// The matchers that compare text, and so can have case ignored
+var caseInsensitiveMatchers = []string{"responseContents", "responseHeaders", "bodyRegex", "headerRegex", "headerMatchers", "reflected",
+	"titleContains", "titleRegex", "generatorContains", "generatorRegex", "jsonPath", "notContains", "notRegex"}
+
+func validateCaseInsensitive(overrides map[string]bool) error {
+	for name := range overrides {
+		if !containsFold(caseInsensitiveMatchers, name) {
+			return errors.New(fmt.Sprintf("caseInsensitive: unknown matcher %v (must be one of %v)", name, strings.Join(caseInsensitiveMatchers, ", ")))
+		}
+	}
+	return nil
+}
+
+// Which regex matched a response, and what it matched
+type RegexMatch struct {
+	Field   string
+	Pattern string
+	Snippet string
+	// How many times it matched, when the matcher has a minCount
+	Count int
+}
+
+func (m RegexMatch) String() string {
+	if m.Count > 0 {
+		return fmt.Sprintf("%v /%v/ matched %q %v", m.Field, m.Pattern, m.Snippet, describeMatchCount(m.Count))
+	}
+	return fmt.Sprintf("%v /%v/ matched %q", m.Field, m.Pattern, m.Snippet)
+}
+
+// Compile the expectation's regexes (following its ignoreCase and caseInsensitive settings like the other matchers),
+// including those of its header matchers, and parse its response codes, hex strings, JSON paths and length delta once
+// at load time
+func compileExpectationRegexes(expectation ExpectedResponse) (ExpectedResponse, error) {
+	var err error
+	if expectation.bodyRegexes, err = compileRegexes(expectation.BodyRegex, "bodyRegex", expectation.ignoresCaseFor("bodyRegex")); err != nil {
+		return expectation, err
+	}
+	if expectation.headerRegexes, err = compileRegexes(expectation.HeaderRegex, "headerRegex", expectation.ignoresCaseFor("headerRegex")); err != nil {
+		return expectation, err
+	}
+	if expectation.notRegexes, err = compileRegexes(expectation.NotRegex, "notRegex", expectation.ignoresCaseFor("notRegex")); err != nil {
+		return expectation, err
+	}
+	if expectation.titleRegexes, err = compileRegexes(expectation.TitleRegex, "titleRegex", expectation.ignoresCaseFor("titleRegex")); err != nil {
+		return expectation, err
+	}
+	if expectation.generatorRegexes, err = compileRegexes(expectation.GeneratorRegex, "generatorRegex", expectation.ignoresCaseFor("generatorRegex")); err != nil {
+		return expectation, err
+	}
+	if expectation.hexPrefixes, err = parseHexPatterns(expectation.HexPrefix, "hexPrefix"); err != nil {
+		return expectation, err
+	}
+	if expectation.hexPatterns, err = parseHexPatterns(expectation.HexContains, "hexContains"); err != nil {
+		return expectation, err
+	}
+	if expectation.HeaderMatchers, err = compileHeaderMatchers(expectation.HeaderMatchers, expectation.ignoresCaseFor("headerMatchers")); err != nil {
+		return expectation, err
+	}
+	if expectation.jsonPaths, err = compileJsonPaths(expectation); err != nil {
+		return expectation, err
+	}
+	if expectation.codeRanges, err = parseCodeRanges(expectation.Codes); err != nil {
+		return expectation, err
+	}
+	if expectation.LengthDeltaGreaterThan != "" {
+		if expectation.lengthDelta, expectation.lengthDeltaPercent, err = parseLengthDelta(expectation.LengthDeltaGreaterThan); err != nil {
+			return expectation, err
+		}
+	}
+	return expectation, nil
+}
+
+// Whether the expectation has any positive matchers, which are what a match is counted on
+func (e ExpectedResponse) hasMatchers() bool {
+	return e.Contents != nil || e.Codes != nil || e.Headers != nil || e.BodyRegex != nil || e.HeaderRegex != nil ||
+		e.HeaderMatchers != nil || e.Reflected != "" || e.Matcher != "" || e.JsonPath != nil || e.usesHtmlElements() || e.HexPrefix != nil || e.HexContains != nil || e.MinLength > 0 || e.MaxLength > 0 || e.MinDelaySeconds > 0 || e.LengthDeltaGreaterThan != "" ||
+		e.Words != nil || e.Lines != nil || e.WordsDeltaFromBaseline != nil || e.LinesDeltaFromBaseline != nil
+}
+
+// Negative matchers alone would match nearly every response (including error pages), so they need at least a
+// response code to go with them
+func validateNegativeMatchers(expectation ExpectedResponse) error {
+	if expectation.NotContains == nil && expectation.NotRegex == nil {
+		return nil
+	}
+
+	if !expectation.hasMatchers() {
+		return errors.New("notContains and notRegex can't be used alone, add at least responseCodes to the expectation")
+	}
+	return nil
+}
+
+// Check whether the response contains anything the expectation rules out. getText returns the part of the response
+// each matcher looks at, lowercased for notContains if it ignores case, while notRegex is matched against the original
+func matchesNegatives(getText func(matcher string, lower bool) string, expectation ExpectedResponse) bool {
+	if expectation.NotContains != nil {
+		ignoreCase := expectation.ignoresCaseFor("notContains")
+		text := getText("notContains", ignoreCase)
+		for _, content := range expectation.NotContains {
+			if ignoreCase {
+				content = strings.ToLower(content)
+			}
+			if strings.Contains(text, content) {
+				return true
+			}
+		}
+	}
+
+	if expectation.notRegexes != nil {
+		text := getText("notRegex", false)
+		for _, regex := range expectation.notRegexes {
+			if regex.MatchString(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compileRegexes(patterns []string, field string, ignoreCase bool) ([]*regexp.Regexp, error) {
+	var regexes []*regexp.Regexp
+	for i, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid %v[%v] %q: %v", field, i, pattern, err))
+		}
+		if ignoreCase {
+			regex = regexp.MustCompile("(?i)" + pattern)
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes, nil
+}
+
+// Find the first regex that matches the body, at least minCount times if it's more than 1
+func matchBodyRegexes(body string, patterns []string, regexes []*regexp.Regexp, minCount int) (RegexMatch, bool) {
+	for i, regex := range regexes {
+		if minCount > 1 {
+			locations := regex.FindAllStringIndex(body, maxCountedMatches)
+			if len(locations) >= minCount {
+				return RegexMatch{Field: "bodyRegex", Pattern: patterns[i], Snippet: truncateSnippet(body[locations[0][0]:locations[0][1]]), Count: len(locations)}, true
+			}
+			continue
+		}
+		if location := regex.FindStringIndex(body); location != nil {
+			return RegexMatch{Field: "bodyRegex", Pattern: patterns[i], Snippet: truncateSnippet(body[location[0]:location[1]])}, true
+		}
+	}
+	return RegexMatch{}, false
+}
+
+// Find the first regex that matches a response header line, formatted as "Name: value" with the canonical header name
+func matchHeaderRegexes(headers http.Header, patterns []string, regexes []*regexp.Regexp) (RegexMatch, bool) {
+	if len(regexes) == 0 {
+		return RegexMatch{}, false
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, regex := range regexes {
+		for _, name := range names {
+			for _, value := range headers[name] {
+				line := name + ": " + value
+				if location := regex.FindStringIndex(line); location != nil {
+					return RegexMatch{Field: "headerRegex", Pattern: patterns[i], Snippet: truncateSnippet(line[location[0]:location[1]])}, true
+				}
+			}
+		}
+	}
+	return RegexMatch{}, false
+}
+
+// Check each header matcher has a condition that makes sense, and compile its regex. The map is copied, as the config's
+// may be shared when reloading
+func compileHeaderMatchers(matchers map[string]HeaderMatcher, ignoreCase bool) (map[string]HeaderMatcher, error) {
+	if matchers == nil {
+		return nil, nil
+	}
+
+	compiled := make(map[string]HeaderMatcher, len(matchers))
+	for name, matcher := range matchers {
+		if matcher.Contains == "" && matcher.Regex == "" && matcher.Exists == nil {
+			return nil, errors.New(fmt.Sprintf("headerMatchers %v needs at least one of contains, regex or exists", http.CanonicalHeaderKey(name)))
+		}
+		if matcher.Exists != nil && !*matcher.Exists && (matcher.Contains != "" || matcher.Regex != "") {
+			return nil, errors.New(fmt.Sprintf("headerMatchers %v can't use contains or regex with exists: false", http.CanonicalHeaderKey(name)))
+		}
+
+		if matcher.Regex != "" {
+			pattern := matcher.Regex
+			if ignoreCase {
+				pattern = "(?i)" + pattern
+			}
+			regex, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid headerMatchers regex for %v %q: %v", http.CanonicalHeaderKey(name), matcher.Regex, err))
+			}
+			matcher.regex = regex
+		}
+		if ignoreCase {
+			matcher.Contains = strings.ToLower(matcher.Contains)
+		}
+		compiled[name] = matcher
+	}
+	return compiled, nil
+}
+
+// Find the first header matcher (by header name) that holds for the response. Names are case-insensitive, and any
+// value of a repeated header (i.e. Set-Cookie) can match, which is returned as "Name: value"
+func matchHeaderMatchers(headers http.Header, matchers map[string]HeaderMatcher, ignoreCase bool) (string, bool) {
+	if len(matchers) == 0 {
+		return "", false
+	}
+
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		matcher := matchers[name]
+		canonicalName := http.CanonicalHeaderKey(name)
+
+		var values []string
+		for header, headerValues := range headers {
+			if strings.EqualFold(header, name) {
+				values = append(values, headerValues...)
+			}
+		}
+
+		if matcher.Exists != nil && !*matcher.Exists {
+			if len(values) == 0 {
+				return fmt.Sprintf("headerMatchers matched missing %v", canonicalName), true
+			}
+			continue
+		}
+
+		for _, value := range values {
+			compared := value
+			if ignoreCase {
+				compared = strings.ToLower(value)
+			}
+			if !strings.Contains(compared, matcher.Contains) {
+				continue
+			}
+			if matcher.regex != nil && !matcher.regex.MatchString(value) {
+				continue
+			}
+			return fmt.Sprintf("headerMatchers matched %q", truncateSnippet(canonicalName+": "+value)), true
+		}
+	}
+	return "", false
+}
+
+func truncateSnippet(snippet string) string {
+	snippet = strings.TrimSpace(snippet)
+	if len(snippet) > maxSnippetLength {
+		return snippet[:maxSnippetLength] + "..."
+	}
+	return snippet
+}
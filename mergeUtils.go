@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Split comma separated -c values, so -c xss.yaml,ssrf.yaml and -c xss.yaml -c ssrf.yaml are the same
+func splitConfigFiles(values multiFlag) multiFlag {
+	var configFiles multiFlag
+	for _, value := range values {
+		for _, configFile := range strings.Split(value, ",") {
+			if configFile = strings.TrimSpace(configFile); configFile != "" {
+				configFiles = append(configFiles, configFile)
+			}
+		}
+	}
+	return configFiles
+}
+
+// Read a config file along with any files it includes, which are resolved relative to it. Included files are merged
+// in order, with later ones winning, and the including file wins over all of them. chain is the files that included
+// this one, so problems in nested files can be traced back to where they were included from
+func readConfigFile(configFile string, chain []string) (Config, configErrors, error) {
+	var fileConfig Config
+	location := strings.Join(append(append([]string(nil), chain...), configFile), " -> ")
+
+	rawConfig, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fileConfig, nil, withIncludeChain(chain, location, err)
+	}
+
+	unknownKeys, err := unmarshalConfig(string(rawConfig), strings.TrimPrefix(filepath.Ext(configFile), "."), &fileConfig)
+	if err != nil {
+		return fileConfig, nil, withIncludeChain(chain, location, err)
+	}
+	if showsConfigLocation(chain) {
+		for i, unknownKey := range unknownKeys {
+			unknownKeys[i] = fmt.Sprintf("%v: %v", location, unknownKey)
+		}
+	}
+
+	fileConfig.ruleSources = make(map[string]string, len(fileConfig.Rules))
+	for rule := range fileConfig.Rules {
+		fileConfig.ruleSources[rule] = configFile
+	}
+	if len(fileConfig.Include) == 0 {
+		return fileConfig, unknownKeys, nil
+	}
+
+	var merged Config
+	for _, include := range fileConfig.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(configFile), include)
+		}
+
+		for _, includedBy := range append(append([]string(nil), chain...), configFile) {
+			if sameFile(include, includedBy) {
+				return fileConfig, nil, errors.New(fmt.Sprintf("include cycle: %v -> %v", location, include))
+			}
+		}
+
+		included, includedUnknownKeys, err := readConfigFile(include, append(append([]string(nil), chain...), configFile))
+		if err != nil {
+			return fileConfig, nil, err
+		}
+		unknownKeys = append(unknownKeys, includedUnknownKeys...)
+		overrideConfig(&merged, included)
+	}
+	overrideConfig(&merged, fileConfig)
+	merged.Include = nil
+	return merged, unknownKeys, nil
+}
+
+// Problems are only prefixed with the file they're in when there's more than one file to tell apart
+func showsConfigLocation(chain []string) bool {
+	return chain != nil || len(opts.ConfigFiles) > 1
+}
+
+// Errors in included files say which files included them, i.e. "main.yaml -> rules/xss.yaml: ..."
+func withIncludeChain(chain []string, location string, err error) error {
+	if !showsConfigLocation(chain) {
+		return err
+	}
+	return errors.New(fmt.Sprintf("%v: %v", location, err))
+}
+
+func sameFile(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// Merge one -c config file into the config loaded so far. Rule names must be unique across files unless
+// -allow-override is set, in which case later files win, like they do for vars and headers. The first file with a
+// Slack, oob or oauth section is the one used, so those settings can be kept in a separate local file
+func mergeConfigFile(c *Config, fileConfig Config, configFile string) error {
+	for _, rule := range getSortedRuleNames(fileConfig.Rules) {
+		if source, exists := c.ruleSources[rule]; exists && !opts.AllowOverride {
+			return errors.New(fmt.Sprintf("rule %v is in both %v and %v (use -allow-override to let later files replace it)", rule, source, fileConfig.ruleSources[rule]))
+		}
+	}
+
+	if c.Slack != nil {
+		fileConfig.Slack = c.Slack
+	}
+	if len(c.Oob) > 0 {
+		fileConfig.Oob = c.Oob
+	}
+	if len(c.OAuth) > 0 {
+		fileConfig.OAuth = c.OAuth
+	}
+	overrideConfig(c, fileConfig)
+	return nil
+}
+
+// Merge override into c, with override winning for rules of the same name, vars, headers and any other values it sets
+func overrideConfig(c *Config, override Config) {
+	if c.Rules == nil {
+		c.Rules = make(map[string]Rule)
+	}
+	if c.ruleSources == nil {
+		c.ruleSources = make(map[string]string)
+	}
+	for rule, ruleData := range override.Rules {
+		c.Rules[rule] = ruleData
+		c.ruleSources[rule] = override.ruleSources[rule]
+	}
+
+	if override.Slack != nil {
+		c.Slack = override.Slack
+	}
+	if len(override.Oob) > 0 {
+		c.Oob = override.Oob
+	}
+	if len(override.OAuth) > 0 {
+		c.OAuth = override.OAuth
+	}
+
+	c.Builtin = append(c.Builtin, override.Builtin...)
+	c.Vars = mergeStringMaps(c.Vars, override.Vars)
+	c.Headers = mergeStringMaps(c.Headers, override.Headers)
+
+	c.Cookies = mergeString(c.Cookies, override.Cookies)
+	c.XmlBody = mergeString(c.XmlBody, override.XmlBody)
+	c.Body = mergeString(c.Body, override.Body)
+	c.BodyContentType = mergeString(c.BodyContentType, override.BodyContentType)
+	c.InjectionPrefix = mergeString(c.InjectionPrefix, override.InjectionPrefix)
+	c.InjectionSuffix = mergeString(c.InjectionSuffix, override.InjectionSuffix)
+}
+
+func mergeString(value string, override string) string {
+	if override != "" {
+		return override
+	}
+	return value
+}
+
+func mergeStringMaps(values map[string]string, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return values
+	}
+
+	merged := make(map[string]string, len(values)+len(overrides))
+	for key, value := range values {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// How many rules were loaded from each config file (before any rule selection), in the order the files were given
+func getRuleSourceCounts(configFiles []string, ruleSources map[string]string) []summaryCount {
+	counts := make(map[string]int)
+	for _, source := range ruleSources {
+		counts[source] += 1
+	}
+
+	sources := append([]string(nil), configFiles...)
+	// Builtin rules added with -merge-builtin come last
+	var others []string
+	for source := range counts {
+		if !containsString(sources, source) {
+			others = append(others, source)
+		}
+	}
+	sort.Strings(others)
+
+	var sourceCounts []summaryCount
+	for _, source := range append(sources, others...) {
+		sourceCounts = append(sourceCounts, summaryCount{name: source, count: counts[source]})
+	}
+	return sourceCounts
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Like containsString, but ignoring case, i.e. for matcher names in maps the config loader has lowercased
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Parsed from -methods
+var requestMethods []string
+
+// HTTP methods are tokens, so anything else would make an invalid request line
+var methodRegex = regexp.MustCompile(`^[A-Z]+$`)
+
+// Split a comma separated list of HTTP methods (i.e. GET,POST,PUT), uppercasing and de-duplicating them
+func parseMethods(methods string) ([]string, error) {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, method := range strings.Split(methods, ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" || seen[method] {
+			continue
+		}
+		if !methodRegex.MatchString(method) {
+			return nil, errors.New(fmt.Sprintf("invalid HTTP method %q", method))
+		}
+		seen[method] = true
+		parsed = append(parsed, method)
+	}
+	return parsed, nil
+}
+
+// Send an injection once with each of the -methods, or as-is without them. Bodies are kept, so body fuzzing rules
+// can be sent with PUT and PATCH as well as POST
+func getMethodInjections(injection Injection) []Injection {
+	if len(requestMethods) == 0 {
+		return []Injection{injection}
+	}
+
+	injections := make([]Injection, 0, len(requestMethods))
+	for _, method := range requestMethods {
+		methodInjection := injection
+		methodInjection.Method = method
+		injections = append(injections, methodInjection)
+	}
+	return injections
+}
+
+// Matches say which method they were found with, unless it's a plain GET
+func describeRequest(method string, u string) string {
+	if method == "" || (method == "GET" && len(requestMethods) == 0) {
+		return u
+	}
+	return method + " " + u
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Replace the host of the nested URL
+	nestedUrlModeHost = "host"
+	// Inject into each query string value of the nested URL
+	nestedUrlModeQuery = "query"
+	// Replace the nested URL entirely
+	nestedUrlModeReplace = "replace"
+
+	// How many extra layers of URL encoding to look through when detecting nested URLs and query strings
+	maxNestedEncodingDepth = 3
+)
+
+// The keys a value needs to count as a nested query string, so free text that happens to have an = isn't one
+var nestedQueryKeyRegex = regexp.MustCompile(`^[\w.\[\]-]+$`)
+
+// Detect parameter values that are URLs themselves (i.e. returnUrl=https%3A%2F%2Fexample.com%2F), looking through
+// extra layers of encoding. Returns the parsed URL and how many more times it was encoded than the outer query string
+func parseNestedUrl(value string) (*url.URL, int, bool) {
+	for depth := 0; depth <= maxNestedEncodingDepth; depth++ {
+		if strings.HasPrefix(value, "//") || strings.HasPrefix(strings.ToLower(value), "http://") || strings.HasPrefix(strings.ToLower(value), "https://") {
+			nested, err := url.Parse(value)
+			if err != nil || nested.Host == "" {
+				return nil, 0, false
+			}
+			return nested, depth, true
+		}
+
+		decoded, err := url.QueryUnescape(value)
+		if err != nil || decoded == value {
+			return nil, 0, false
+		}
+		value = decoded
+	}
+	return nil, 0, false
+}
+
+// Re-apply the extra layers of encoding the nested URL originally had, so the outer query string encodes it back to
+// the same depth rather than partially decoded
+func encodeNestedUrl(value string, depth int) string {
+	for i := 0; i < depth; i++ {
+		value = url.QueryEscape(value)
+	}
+	return value
+}
+
+func getNestedUrlVariants(nested *url.URL, param string, injection string, mode string) []ValueVariant {
+	var variants []ValueVariant
+	switch strings.ToLower(mode) {
+	case nestedUrlModeHost:
+		injected := *nested
+		injected.Host = expandRequestTemplates(injection, param)
+		variants = append(variants, ValueVariant{Value: injected.String(), Path: "host", Payload: injected.Host})
+	case nestedUrlModeQuery:
+		nestedQueryStrings, err := url.ParseQuery(nested.RawQuery)
+		if err != nil {
+			return nil
+		}
+		for _, qs := range getSortedParams(nestedQueryStrings) {
+			for index, val := range nestedQueryStrings[qs] {
+				payload := expandRequestTemplates(injection, param)
+				nestedQueryStrings[qs][index] = payload
+				// Nested query strings are always encoded, so this can't fail
+				rawQuery, _ := encodeQueryStrings(nestedQueryStrings, nested.RawQuery, false)
+				injected := *nested
+				injected.RawQuery = rawQuery
+				nestedQueryStrings[qs][index] = val
+				variants = append(variants, ValueVariant{Value: injected.String(), Path: "query " + qs, Payload: payload})
+			}
+		}
+	case nestedUrlModeReplace:
+		payload := expandRequestTemplates(injection, param)
+		variants = append(variants, ValueVariant{Value: payload, Path: "url", Payload: payload})
+	}
+	return variants
+}
+
+// Inject into URLs nested within parameter values, based on the rule's nestedUrl mode. Parameters that don't hold
+// a URL are skipped
+func getInjectedNestedUrls(u *url.URL, ruleInjections []string, mode string, decode bool) ([]Injection, error) {
+	queryStrings, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, qs := range getSortedParams(queryStrings) {
+			for index, val := range queryStrings[qs] {
+				nested, depth, ok := parseNestedUrl(val)
+				if !ok {
+					continue
+				}
+
+				for _, variant := range getNestedUrlVariants(nested, qs, injection, mode) {
+					queryStrings[qs][index] = encodeNestedUrl(variant.Value, depth)
+					rawQuery, err := encodeQueryStrings(queryStrings, u.RawQuery, decode)
+
+					// Set back to original qs val to ensure we only update one parameter at a time
+					queryStrings[qs][index] = val
+
+					if err != nil {
+						logParseError("Error decoding parameters: %v\n", err)
+						continue
+					}
+
+					injectedUrl := *u
+					injectedUrl.RawQuery = rawQuery
+					replacedUrls = append(replacedUrls, Injection{Url: injectedUrl.String(), Param: qs, Location: fmt.Sprintf("nested %v in %v", variant.Path, describeParam(qs, index, len(queryStrings[qs]))), Payload: injection, SentPayloads: []string{variant.Payload}})
+				}
+			}
+		}
+	}
+	return replacedUrls, nil
+}
+
+// Detect parameter values that are query strings themselves (i.e. data=a%3D1%26b%3D2), looking through extra layers of
+// encoding like nested URLs. Returns the nested query string and how many more times it was encoded than the outer one
+func parseNestedQuery(value string) (string, int, bool) {
+	for depth := 0; depth <= maxNestedEncodingDepth; depth++ {
+		if isNestedQuery(value) {
+			return value, depth, true
+		}
+
+		decoded, err := url.QueryUnescape(value)
+		if err != nil || decoded == value {
+			return "", 0, false
+		}
+		value = decoded
+	}
+	return "", 0, false
+}
+
+// Every pair needs a plain key and an =, and a value that doesn't start with another =, so base64 padding (i.e.
+// YWJjZA==) isn't mistaken for a query string
+func isNestedQuery(value string) bool {
+	if !strings.Contains(value, "=") {
+		return false
+	}
+	for _, pair := range strings.Split(value, "&") {
+		separator := strings.Index(pair, "=")
+		if separator < 0 || !nestedQueryKeyRegex.MatchString(pair[:separator]) || strings.HasPrefix(pair[separator+1:], "=") {
+			return false
+		}
+	}
+	_, err := url.ParseQuery(value)
+	return err == nil
+}
+
+// Inject into each value of a nested query string, one at a time, encoding it back to the depth it was found at
+func getNestedQueryVariants(rawQuery string, depth int, param string, injection string) []ValueVariant {
+	nestedQueryStrings, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil
+	}
+
+	var variants []ValueVariant
+	for _, qs := range getSortedParams(nestedQueryStrings) {
+		for index, val := range nestedQueryStrings[qs] {
+			payload := expandRequestTemplates(injection, param)
+			nestedQueryStrings[qs][index] = payload
+			// Nested query strings are always encoded, so this can't fail
+			injected, _ := encodeQueryStrings(nestedQueryStrings, rawQuery, false)
+			nestedQueryStrings[qs][index] = val
+			variants = append(variants, ValueVariant{Value: encodeNestedUrl(injected, depth), Path: "nested " + qs, Payload: payload})
+		}
+	}
+	return variants
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseNestedUrl(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		url   string
+		depth int
+		ok    bool
+	}{
+		{"plain", "https://example.com/a?b=1", "https://example.com/a?b=1", 0, true},
+		{"protocol relative", "//example.com/a", "//example.com/a", 0, true},
+		{"encoded", "https%3A%2F%2Fexample.com%2Fa%3Fb%3D1", "https://example.com/a?b=1", 1, true},
+		{"double encoded", "https%253A%252F%252Fexample.com%252Fa%253Fb%253D1", "https://example.com/a?b=1", 2, true},
+		{"uppercase scheme", "HTTPS%3A%2F%2Fexample.com%2F", "https://example.com/", 1, true},
+		{"not a url", "hello", "", 0, false},
+		{"path only", "%2Fa%2Fb", "", 0, false},
+		{"no host", "https%3A%2F%2F", "", 0, false},
+		{"too deeply encoded", "https%25252525253A%25252525252F%25252525252Fexample.com", "", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nested, depth, ok := parseNestedUrl(test.value)
+			if ok != test.ok {
+				t.Fatalf("parseNestedUrl(%q) ok = %v, want %v", test.value, ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if nested.String() != test.url || depth != test.depth {
+				t.Errorf("parseNestedUrl(%q) = %q at depth %v, want %q at depth %v", test.value, nested.String(), depth, test.url, test.depth)
+			}
+		})
+	}
+}
+
+func TestEncodeNestedUrl(t *testing.T) {
+	tests := []struct {
+		value string
+		depth int
+		want  string
+	}{
+		{"https://example.com/", 0, "https://example.com/"},
+		{"https://example.com/", 1, "https%3A%2F%2Fexample.com%2F"},
+		{"https://example.com/", 2, "https%253A%252F%252Fexample.com%252F"},
+	}
+
+	for _, test := range tests {
+		if got := encodeNestedUrl(test.value, test.depth); got != test.want {
+			t.Errorf("encodeNestedUrl(%q, %v) = %q, want %q", test.value, test.depth, got, test.want)
+		}
+		// Encoding back to the depth a nested URL was found at has to round trip
+		if nested, depth, ok := parseNestedUrl(test.want); !ok || nested.String() != test.value || depth != test.depth {
+			t.Errorf("parseNestedUrl(%q) didn't round trip to %q at depth %v", test.want, test.value, test.depth)
+		}
+	}
+}
+
+func TestGetInjectedNestedUrls(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawUrl    string
+		mode      string
+		injection string
+		want      []string
+	}{
+		{
+			name:      "host of an encoded url",
+			rawUrl:    "https://target.com/?next=https%3A%2F%2Fexample.com%2Fa%3Fb%3D1",
+			mode:      nestedUrlModeHost,
+			injection: "evil.com",
+			want:      []string{"https://target.com/?next=https%3A%2F%2Fevil.com%2Fa%3Fb%3D1"},
+		},
+		{
+			name:      "host of a double encoded url",
+			rawUrl:    "https://target.com/?next=https%253A%252F%252Fexample.com%252F",
+			mode:      nestedUrlModeHost,
+			injection: "evil.com",
+			want:      []string{"https://target.com/?next=https%253A%252F%252Fevil.com%252F"},
+		},
+		{
+			name:      "query of a double encoded url",
+			rawUrl:    "https://target.com/?next=https%253A%252F%252Fexample.com%252F%253Fa%253D1%2526b%253D2",
+			mode:      nestedUrlModeQuery,
+			injection: "x\"y",
+			want: []string{
+				"https://target.com/?next=https%253A%252F%252Fexample.com%252F%253Fa%253Dx%252522y%2526b%253D2",
+				"https://target.com/?next=https%253A%252F%252Fexample.com%252F%253Fa%253D1%2526b%253Dx%252522y",
+			},
+		},
+		{
+			name:      "replace a triple encoded url",
+			rawUrl:    "https://target.com/?next=https%25253A%25252F%25252Fexample.com",
+			mode:      nestedUrlModeReplace,
+			injection: "https://evil.com/",
+			want:      []string{"https://target.com/?next=https%25253A%25252F%25252Fevil.com%25252F"},
+		},
+		{
+			name:      "parameters without a url are skipped",
+			rawUrl:    "https://target.com/?a=1&next=https%3A%2F%2Fexample.com",
+			mode:      nestedUrlModeHost,
+			injection: "evil.com",
+			want:      []string{"https://target.com/?a=1&next=https%3A%2F%2Fevil.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.rawUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			injections, err := getInjectedNestedUrls(u, []string{test.injection}, test.mode, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(injections) != len(test.want) {
+				t.Fatalf("got %v injections, want %v: %v", len(injections), len(test.want), injections)
+			}
+			for i, injection := range injections {
+				if injection.Url != test.want[i] {
+					t.Errorf("injection %v = %q, want %q", i, injection.Url, test.want[i])
+				}
+				if injection.Param != "next" {
+					t.Errorf("injection %v param = %q, want next", i, injection.Param)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Tokens are refreshed this long before they expire, so requests in flight don't go out with an expired token
+	oauthRefreshMargin = 30 * time.Second
+	// When fetching a token fails, requests are paused and it's retried this many times, waiting longer each time
+	oauthRetries    = 5
+	oauthRetryDelay = 5 * time.Second
+)
+
+// Fetches access tokens with the OAuth2 client credentials grant, refreshing them before they expire
+type OAuthClient struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scope        string
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+var oauthClient *OAuthClient
+
+// Check the oauth section of the config has what's needed to fetch a token, resolving clientSecretEnv if it's set
+func validateOAuthConfig(oauth map[string]string) error {
+	if oauth["tokenurl"] == "" || oauth["clientid"] == "" {
+		return errors.New("oauth: requires a tokenUrl and a clientId")
+	}
+
+	tokenUrl, err := url.Parse(oauth["tokenurl"])
+	if err != nil || tokenUrl.Scheme == "" || tokenUrl.Host == "" {
+		return errors.New(fmt.Sprintf("oauth: tokenUrl %q is not a valid URL", oauth["tokenurl"]))
+	}
+
+	if secretEnv := oauth["clientsecretenv"]; secretEnv != "" {
+		oauth["clientsecret"] = strings.TrimSpace(os.Getenv(secretEnv))
+	}
+	return nil
+}
+
+// Set up the client for the oauth section of the config, fetching the first token up front so bad credentials fail
+// the scan before it starts rather than every request
+func createOAuthClient() error {
+	if len(config.OAuth) == 0 {
+		return nil
+	}
+
+	client := &OAuthClient{
+		tokenUrl:     config.OAuth["tokenurl"],
+		clientId:     config.OAuth["clientid"],
+		clientSecret: config.OAuth["clientsecret"],
+		scope:        config.OAuth["scope"],
+	}
+	if err := client.refresh(); err != nil {
+		return errors.New(fmt.Sprintf("unable to fetch an OAuth2 token from %v: %v", client.tokenUrl, err))
+	}
+	oauthClient = client
+	return nil
+}
+
+// The Authorization header for a request, refreshing the token first if it's about to expire. Refreshing holds the
+// lock, so every request waits on it rather than being sent with an expired token
+func (client *OAuthClient) getAuthorizationHeader() (string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.expires.IsZero() || time.Now().Before(client.expires) {
+		return "Bearer " + client.token, nil
+	}
+
+	var err error
+	delay := oauthRetryDelay
+	for attempt := 1; attempt <= oauthRetries; attempt++ {
+		if err = client.refresh(); err == nil {
+			return "Bearer " + client.token, nil
+		}
+		if !opts.QuietErrors {
+			printRed(os.Stderr, "Unable to refresh the OAuth2 token (attempt %v of %v), pausing for %v: %v\n", attempt, oauthRetries, delay, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return "", errors.New(fmt.Sprintf("unable to refresh the OAuth2 token: %v", err))
+}
+
+func (client *OAuthClient) refresh() error {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if client.scope != "" {
+		form.Set("scope", client.scope)
+	}
+
+	request, err := http.NewRequest("POST", client.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(client.clientId), url.QueryEscape(client.clientSecret))
+
+	resp, err := config.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("token endpoint returned status %v: %v", resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+
+	var token oauthTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse the token response: %v", err))
+	}
+	if token.AccessToken == "" {
+		return errors.New("token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return errors.New(fmt.Sprintf("unsupported token type %q (only bearer tokens are supported)", token.TokenType))
+	}
+
+	client.token = token.AccessToken
+	client.expires = time.Time{}
+	if token.ExpiresIn > 0 {
+		// Short-lived tokens are refreshed halfway through their lifetime instead, so they're not refreshed constantly
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		margin := oauthRefreshMargin
+		if margin > lifetime/2 {
+			margin = lifetime / 2
+		}
+		client.expires = time.Now().Add(lifetime - margin)
+	}
+
+	if opts.Debug {
+		printRed(os.Stderr, "Fetched an OAuth2 token from %v (expires in %vs)\n", client.tokenUrl, token.ExpiresIn)
+	}
+	return nil
+}
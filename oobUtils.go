@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// interactsh uses the first 20 characters of a subdomain to route interactions to the registered client, and the
+	// rest (the nonce) to tell them apart
+	oobCorrelationIdLength = 20
+	oobNonceLength         = 13
+	oobIdAlphabet          = "0123456789abcdefghijklmnopqrstuv"
+
+	oobPollInterval = 5 * time.Second
+)
+
+type OobClient struct {
+	server        *url.URL
+	token         string
+	domain        string
+	correlationId string
+	secretKey     string
+	privateKey    *rsa.PrivateKey
+	polling       bool
+
+	mutex        sync.Mutex
+	pendingIds   []string
+	correlations map[string]OobCorrelation
+	stop         chan bool
+	stopped      chan bool
+}
+
+// What an [[oob]] value was sent in, so interactions can be mapped back to the originating request
+type OobCorrelation struct {
+	RuleName string
+	RuleData Rule
+	Injection
+}
+
+type OobInteraction struct {
+	Protocol      string `json:"protocol"`
+	UniqueId      string `json:"unique-id"`
+	FullId        string `json:"full-id"`
+	RemoteAddress string `json:"remote-address"`
+	Timestamp     string `json:"timestamp"`
+}
+
+type oobPollResponse struct {
+	Data   []string `json:"data"`
+	AesKey string   `json:"aes_key"`
+}
+
+var oobClient *OobClient
+
+// Set up the client for [[oob]] templates. With -oob, the client registers with the interactsh server in the config
+// and polls it for interactions. Otherwise a generic callback domain can be set in the config with no polling
+func createOobClient() error {
+	if !opts.Oob {
+		if config.Oob["domain"] == "" {
+			return nil
+		}
+		oobClient = &OobClient{domain: strings.ToLower(config.Oob["domain"])}
+		return nil
+	}
+
+	server, err := url.Parse(config.Oob["server"])
+	if err != nil || server.Host == "" {
+		return errors.New("-oob flag enabled, but a valid oob server (i.e. https://oast.fun) is not set in the config file")
+	}
+
+	privateKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	client := &OobClient{
+		server:        server,
+		token:         config.Oob["token"],
+		domain:        strings.ToLower(server.Hostname()),
+		correlationId: cryptoRandomString(oobCorrelationIdLength),
+		secretKey:     cryptoRandomString(32),
+		privateKey:    privateKey,
+		polling:       true,
+		correlations:  make(map[string]OobCorrelation),
+		stop:          make(chan bool),
+		stopped:       make(chan bool),
+	}
+
+	// Interactions can be sent to a different domain than the server's API host if needed
+	if config.Oob["domain"] != "" {
+		client.domain = strings.ToLower(config.Oob["domain"])
+	}
+
+	if err := client.register(); err != nil {
+		return errors.New(fmt.Sprintf("unable to register with oob server %v: %v", server.Host, err))
+	}
+
+	oobClient = client
+	go client.pollPeriodically()
+	return nil
+}
+
+// Generate a unique subdomain of the callback domain for a single [[oob]] template
+func (c *OobClient) newId() string {
+	id := c.correlationId
+	for i := 0; i < oobNonceLength; i++ {
+		id += string(oobIdAlphabet[random.Intn(len(oobIdAlphabet))])
+	}
+
+	if c.polling {
+		c.mutex.Lock()
+		c.pendingIds = append(c.pendingIds, id)
+		c.mutex.Unlock()
+	}
+	return id + "." + c.domain
+}
+
+// Map the [[oob]] ids generated for a URL and rule back to the requests that contain them. Ids that can't be found
+// (i.e. because they were base64 encoded) map back to the URL the requests were generated for
+func (c *OobClient) correlate(u string, ruleName string, ruleData Rule, tasks []Task) {
+	if !c.polling {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, id := range c.pendingIds {
+		correlation := OobCorrelation{RuleName: ruleName, RuleData: ruleData, Injection: Injection{Url: u}}
+		for _, task := range tasks {
+			if taskContainsOobId(task, id) {
+				correlation.Injection = task.Injection
+				break
+			}
+		}
+		c.correlations[id] = correlation
+	}
+	c.pendingIds = nil
+}
+
+func taskContainsOobId(t Task, id string) bool {
+	if strings.Contains(strings.ToLower(fullyDecode(t.Url)), id) || strings.Contains(strings.ToLower(t.Body), id) {
+		return true
+	}
+	if strings.Contains(strings.ToLower(t.Cookies), id) {
+		return true
+	}
+	for _, value := range t.Headers {
+		if strings.Contains(strings.ToLower(value), id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OobClient) register() error {
+	publicKey, err := x509.MarshalPKIXPublicKey(&c.privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	encodedKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: publicKey})
+
+	content := map[string]string{
+		"public-key":     base64.StdEncoding.EncodeToString(encodedKey),
+		"secret-key":     c.secretKey,
+		"correlation-id": c.correlationId,
+	}
+	_, err = c.sendRequest("POST", "/register", content)
+	return err
+}
+
+func (c *OobClient) deregister() error {
+	content := map[string]string{
+		"secret-key":     c.secretKey,
+		"correlation-id": c.correlationId,
+	}
+	_, err := c.sendRequest("POST", "/deregister", content)
+	return err
+}
+
+func (c *OobClient) poll() ([]OobInteraction, error) {
+	body, err := c.sendRequest("GET", fmt.Sprintf("/poll?id=%v&secret=%v", c.correlationId, c.secretKey), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response oobPollResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Data) == 0 {
+		return nil, nil
+	}
+
+	// Interactions are AES encrypted, with the key encrypted using the public key sent when registering
+	encryptedKey, err := base64.StdEncoding.DecodeString(response.AesKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), crand.Reader, c.privateKey, encryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var interactions []OobInteraction
+	for _, data := range response.Data {
+		ciphertext, err := base64.StdEncoding.DecodeString(data)
+		if err != nil || len(ciphertext) < aes.BlockSize {
+			continue
+		}
+
+		plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+		cipher.NewCFBDecrypter(block, ciphertext[:aes.BlockSize]).XORKeyStream(plaintext, ciphertext[aes.BlockSize:])
+
+		var interaction OobInteraction
+		if err := json.Unmarshal(plaintext, &interaction); err != nil {
+			continue
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+func (c *OobClient) sendRequest(method string, path string, content map[string]string) ([]byte, error) {
+	requestBody := bytes.NewReader(nil)
+	if content != nil {
+		jsonContent, err := json.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		requestBody = bytes.NewReader(jsonContent)
+	}
+
+	request, err := http.NewRequest(method, strings.TrimSuffix(c.server.String(), "/")+path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		request.Header.Set("Authorization", c.token)
+	}
+
+	resp, err := config.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("unexpected status code %v: %v", resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	return body, nil
+}
+
+func (c *OobClient) pollPeriodically() {
+	ticker := time.NewTicker(oobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.reportInteractions()
+		case <-c.stop:
+			c.stopped <- true
+			return
+		}
+	}
+}
+
+func (c *OobClient) reportInteractions() {
+	interactions, err := c.poll()
+	if err != nil {
+		if opts.Debug {
+			printRed(os.Stderr, "error polling oob server: %v\n", err)
+		}
+		return
+	}
+
+	for _, interaction := range interactions {
+		id := strings.ToLower(interaction.FullId)
+		if len(id) > oobCorrelationIdLength+oobNonceLength {
+			id = id[:oobCorrelationIdLength+oobNonceLength]
+		}
+
+		c.mutex.Lock()
+		correlation, exists := c.correlations[id]
+		c.mutex.Unlock()
+
+		if !exists {
+			if opts.Debug {
+				printRed(os.Stderr, "received %v oob interaction from %v for unknown id %v\n", interaction.Protocol, interaction.RemoteAddress, interaction.FullId)
+			}
+			continue
+		}
+
+		reportOobInteraction(correlation, interaction)
+	}
+}
+
+// Wait for any late callbacks, then do a final poll and deregister from the server
+func (c *OobClient) close(wait time.Duration) {
+	if !c.polling {
+		return
+	}
+
+	if wait > 0 {
+		if !opts.SilentMode {
+			printCyan(os.Stderr, "Waiting %v for any late out-of-band interactions\n", wait)
+		}
+		time.Sleep(wait)
+	}
+
+	c.stop <- true
+	<-c.stopped
+	c.reportInteractions()
+
+	if err := c.deregister(); err != nil && opts.Debug {
+		printRed(os.Stderr, "error deregistering from oob server: %v\n", err)
+	}
+}
+
+func reportOobInteraction(correlation OobCorrelation, interaction OobInteraction) {
+	u := fullyDecode(correlation.Url)
+	if correlation.Location != "" {
+		u = fmt.Sprintf("%v (injected at %v)", u, correlation.Location)
+	} else if correlation.Param != "" {
+		u = fmt.Sprintf("%v (injected at %v)", u, correlation.Param)
+	}
+
+	severity := correlation.RuleData.Severity
+	if !meetsMinSeverity(severity) {
+		return
+	}
+
+	match := fmt.Sprintf("out-of-band %v interaction from %v for %v\n", strings.ToUpper(interaction.Protocol), interaction.RemoteAddress, u)
+	result := EvaluationResult{
+		RuleName:        correlation.RuleName,
+		RuleDescription: correlation.RuleData.Description,
+		InjectedUrl:     correlation.Url,
+		Location:        correlation.Location,
+		Severity:        severity,
+		Method:          correlation.Method,
+		Param:           correlation.Param,
+		Payload:         correlation.Payload,
+		Match:           match,
+	}
+	if isSuppressed(result) {
+		return
+	}
+
+	evaluationResultsMutex.Lock()
+	evaluationResults = append(evaluationResults, result)
+	evaluationResultsMutex.Unlock()
+
+	printMatch(correlation.RuleName, severity, match)
+	if opts.ToSlack {
+		if err := sendSlackMessage(formatFindingDetails(match, result), severity, correlation.RuleData.Tags); err != nil && opts.Debug {
+			printRed(os.Stderr, "error sending Slack message: %v\n", err)
+		}
+	}
+}
+
+func cryptoRandomString(length int) string {
+	value := make([]byte, length)
+	if _, err := crand.Read(value); err != nil {
+		panic(err)
+	}
+	for i := range value {
+		value[i] = oobIdAlphabet[int(value[i])%len(oobIdAlphabet)]
+	}
+	return string(value)
+}
+
+func usesOobTemplate(injection string) bool {
+	return strings.Contains(injection, "[[oob]]")
+}
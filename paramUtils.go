@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Compile the rule's paramRegex once at load time. Parameter names are matched case-insensitively, as they're usually
+// written in whatever case the application happens to use (i.e. returnUrl or returnURL)
+func compileParamRegex(ruleData Rule) (Rule, error) {
+	if ruleData.ParamRegex == "" {
+		return ruleData, nil
+	}
+	regex, err := regexp.Compile("(?i)" + ruleData.ParamRegex)
+	if err != nil {
+		return ruleData, errors.New(fmt.Sprintf("paramRegex: invalid regex %q: %v", ruleData.ParamRegex, err))
+	}
+	ruleData.paramRegex = regex
+	return ruleData, nil
+}
+
+// Whether the rule injects into a parameter, which it does for every parameter unless it has a paramRegex
+func (r Rule) injectsParam(param string) bool {
+	return r.paramRegex == nil || r.paramRegex.MatchString(param)
+}
+
+// Drop injections into parameters the rule's paramRegex doesn't match, for the injection modes that don't skip them
+// as they go. Combinations are only kept if every parameter in them matches
+func filterInjectionsByParam(injections []Injection, ruleData Rule) []Injection {
+	if ruleData.paramRegex == nil {
+		return injections
+	}
+
+	filtered := make([]Injection, 0, len(injections))
+	for _, injection := range injections {
+		selected := true
+		for _, param := range strings.Split(injection.Param, ", ") {
+			selected = selected && ruleData.injectsParam(strings.TrimSuffix(param, "[]"))
+		}
+		if selected {
+			filtered = append(filtered, injection)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	partBody    = "body"
+	partHeaders = "headers"
+	partAll     = "all"
+)
+
+// The matchers that look for content, which can be pointed at the body (the default), the headers or both
+var partMatchers = []string{"responseContents", "bodyRegex", "reflected", "notContains", "notRegex"}
+
+func validatePart(field string, part string) error {
+	switch strings.ToLower(part) {
+	case "", partBody, partHeaders, partAll:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%v: invalid part %q (must be %v, %v or %v)", field, part, partBody, partHeaders, partAll))
+}
+
+func validateParts(expectation ExpectedResponse) error {
+	if err := validatePart("part", expectation.Part); err != nil {
+		return err
+	}
+	for name, part := range expectation.Parts {
+		if !containsFold(partMatchers, name) {
+			return errors.New(fmt.Sprintf("parts: unknown matcher %v (must be one of %v)", name, strings.Join(partMatchers, ", ")))
+		}
+		if err := validatePart("parts."+name, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Which part of the response a content matcher looks at, which is part unless parts overrides it for that matcher
+func (e ExpectedResponse) partFor(matcher string) string {
+	for name, part := range e.Parts {
+		if strings.EqualFold(name, matcher) {
+			return strings.ToLower(part)
+		}
+	}
+	if e.Part == "" {
+		return partBody
+	}
+	return strings.ToLower(e.Part)
+}
+
+// The text a content matcher is compared against. Headers are "Name: value" lines like headerRegex matches, and with
+// all they come before the body, separated by a blank line like in the raw response
+func getResponsePart(resp Response, part string) string {
+	switch part {
+	case partHeaders:
+		return formatExpressionHeaders(resp.Headers)
+	case partAll:
+		return formatExpressionHeaders(resp.Headers) + "\n\n" + resp.Body
+	}
+	return resp.Body
+}
+
+// Whether any of the expectation's matchers need the response body, rather than just its status and headers
+func (e ExpectedResponse) usesBody() bool {
+	for matcher, used := range map[string]bool{
+		"responseContents": e.Contents != nil,
+		"bodyRegex":        e.BodyRegex != nil,
+		"reflected":        e.Reflected != "",
+		"notContains":      e.NotContains != nil,
+		"notRegex":         e.NotRegex != nil,
+	} {
+		if used && e.partFor(matcher) != partHeaders {
+			return true
+		}
+	}
+	return e.Matcher != "" || e.JsonPath != nil || e.usesHtmlElements() || e.HexPrefix != nil || e.HexContains != nil || e.MinLength > 0 ||
+		e.MaxLength > 0 || e.LengthDeltaGreaterThan != "" || e.Words != nil || e.Lines != nil ||
+		e.WordsDeltaFromBaseline != nil || e.LinesDeltaFromBaseline != nil
+}
+
+// Whether the rule's requests need their response bodies read, which header-only rules skip, as reading (and
+// converting) huge bodies is wasted on them
+func (r Rule) usesBody() bool {
+	for _, expectation := range r.getExpectations() {
+		if expectation.usesBody() {
+			return true
+		}
+	}
+	for _, step := range r.Verify {
+		if step.Expectation.usesBody() {
+			return true
+		}
+	}
+	for _, extractor := range r.Extractors {
+		if !strings.EqualFold(extractor.Part, extractorPartHeaders) {
+			return true
+		}
+	}
+	return false
+}
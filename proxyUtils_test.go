@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsProxyError(t *testing.T) {
+	refused := errors.New("connect: connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"dialing the proxy", &url.Error{Op: "Get", URL: "http://example.com/", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: refused}}, true},
+		{"SOCKS5 handshake", &url.Error{Op: "Get", URL: "http://example.com/", Err: &net.OpError{Op: "socks connect", Net: "tcp", Err: refused}}, true},
+		{"CONNECT refused by the proxy", &url.Error{Op: "Get", URL: "https://example.com/", Err: errors.New("Proxy Authentication Required")}, true},
+		{"dialing the target", &url.Error{Op: "Get", URL: "http://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: refused}}, false},
+		{"timing out", &url.Error{Op: "Get", URL: "http://example.com/", Err: errors.New("context deadline exceeded")}, false},
+		{"not a request error", errors.New("Bad Gateway"), false},
+	}
+
+	for _, test := range tests {
+		if got := isProxyError(test.err); got != test.want {
+			t.Errorf("%v: isProxyError = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
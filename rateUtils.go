@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A token bucket shared by every worker for -rate, holding at most one token so requests are spread evenly rather
+// than sent in bursts
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// Set from -rate when it's above 0
+var limiter *rateLimiter
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: 1, last: time.Now()}
+}
+
+// Wait for a token. Each caller reserves its token straight away (leaving the bucket in debt if it's empty), so
+// concurrent callers queue up in order and only sleep outside the lock
+func (l *rateLimiter) wait() {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > 1 {
+		l.tokens = 1
+	}
+	l.last = now
+	l.tokens -= 1
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+// How long until a token is free, without taking it
+func (l *rateLimiter) getDelay() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	tokens := l.tokens + time.Since(l.last).Seconds()*l.rate
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) getRate() float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
+
+// Change the rate, keeping the tokens built up at the old one
+func (l *rateLimiter) setRate(rate float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > 1 {
+		l.tokens = 1
+	}
+	l.last = now
+	l.rate = rate
+}
+
+// Called just before each request is sent (including retries), and before its timeout starts, so time spent waiting
+// for a token never counts against it
+func waitForRateLimit(u string) {
+	if scheduler != nil {
+		scheduler.waitForHost(u)
+	}
+	if limiter != nil {
+		limiter.wait()
+	}
+}
+
+// How often (in requests) the progress update is printed: every 1,000 requests, or about every 10 seconds with -rate,
+// which could otherwise take a long time to reach 1,000
+func getProgressInterval() int {
+	if opts.Rate > 0 && opts.Rate < 100 {
+		if interval := int(opts.Rate * 10); interval > 1 {
+			return interval
+		}
+		return 1
+	}
+	return 1000
+}
+
+// The achieved request rate for status lines, along with the -rate limit so it can be seen to be working
+func describeRequestRate(requests int64, secondsElapsed float64) string {
+	perSecond := float64(requests) / secondsElapsed
+	if opts.Rate > 0 {
+		return fmt.Sprintf("%.1f requests per second (limited to %v)", perSecond, opts.Rate)
+	}
+	return fmt.Sprintf("%v requests per second", int(perSecond))
+}
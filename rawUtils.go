@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Inject into each parameter by rewriting the raw query string by hand, so the payload reaches the server byte-for-byte
+// (i.e. an already encoded %27 isn't re-encoded to %2527). The other parameters keep their original encoding and order
+func getInjectedRawUrls(u *url.URL, ruleInjections []string) []Injection {
+	if u.RawQuery == "" {
+		return nil
+	}
+	pairs := strings.Split(u.RawQuery, "&")
+
+	params := make([]string, len(pairs))
+	occurrences := make(map[string]int)
+	for index, pair := range pairs {
+		rawParam := strings.SplitN(pair, "=", 2)[0]
+		param, err := url.QueryUnescape(rawParam)
+		if err != nil {
+			param = rawParam
+		}
+		params[index] = param
+		occurrences[param] += 1
+	}
+
+	var replacedUrls []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		seen := make(map[string]int)
+		for index, pair := range pairs {
+			rawParam := strings.SplitN(pair, "=", 2)[0]
+			if rawParam == "" {
+				continue
+			}
+			param := params[index]
+
+			injected := append([]string(nil), pairs...)
+			payload := expandRequestTemplates(injection, param)
+			injected[index] = rawParam + "=" + payload
+
+			var location string
+			if occurrences[param] > 1 {
+				location = describeParam(param, seen[param], occurrences[param])
+			}
+			seen[param] += 1
+
+			injectedUrl := *u
+			injectedUrl.RawQuery = strings.Join(injected, "&")
+			replacedUrls = append(replacedUrls, Injection{Url: injectedUrl.String(), Param: param, Location: location, Payload: injection, SentPayloads: []string{payload}})
+		}
+	}
+	return replacedUrls
+}
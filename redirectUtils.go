@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Go's http.Client gives up after this many redirects, which is kept as the default for rules that don't set
+// maxRedirects
+const defaultMaxRedirects = 10
+
+// Where -redirect-scope lets redirects go, relative to the URL that was requested
+const (
+	redirectScopeSameHost   = "same-host"
+	redirectScopeSameDomain = "same-domain"
+	redirectScopeAny        = "any"
+)
+
+type redirectPolicyKey struct{}
+
+// How a single request handles redirects, passed to the shared client's CheckRedirect through the request's context.
+// Without maxRedirects, too many redirects fail the request like they do by default, rather than the last one being
+// evaluated. Redirects counts the hops followed, and locations has the Location of every redirect response (including
+// one that wasn't followed), for matchers and the finding
+type redirectPolicy struct {
+	follow       bool
+	maxRedirects int
+	scope        string
+	redirects    int
+	locations    []string
+	outOfScope   bool
+}
+
+// The rule's followRedirects and maxRedirects, or else -follow-redirects and -max-redirects. Setting maxRedirects
+// follows redirects for the rule even with -follow-redirects=false
+func (r Rule) getRedirectPolicy() *redirectPolicy {
+	policy := &redirectPolicy{follow: opts.FollowRedirects, maxRedirects: r.MaxRedirects, scope: opts.RedirectScope}
+	if r.MaxRedirects > 0 {
+		policy.follow = true
+	} else {
+		policy.maxRedirects = opts.MaxRedirects
+	}
+	if r.FollowRedirects != nil {
+		policy.follow = *r.FollowRedirects
+	}
+	return policy
+}
+
+func validateRedirectScope(scope string) error {
+	switch scope {
+	case redirectScopeSameHost, redirectScopeSameDomain, redirectScopeAny:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("redirect-scope flag: invalid scope %q (must be %v, %v or %v)", scope, redirectScopeSameHost, redirectScopeSameDomain, redirectScopeAny))
+}
+
+// Whether a redirect to u stays within scope of the URL that was first requested. same-host compares the host and
+// port, ignoring a switch between http and https on their default ports, and same-domain the registrable domain
+func isRedirectInScope(scope string, origin *url.URL, u *url.URL) bool {
+	switch scope {
+	case redirectScopeSameHost:
+		return getUrlHost(origin) == getUrlHost(u)
+	case redirectScopeSameDomain:
+		return strings.EqualFold(getRootDomain(strings.ToLower(origin.Hostname())), getRootDomain(strings.ToLower(u.Hostname())))
+	}
+	return true
+}
+
+func withRedirectPolicy(request *http.Request, policy *redirectPolicy) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), redirectPolicyKey{}, policy))
+}
+
+// The shared client's CheckRedirect, following each request's own policy. Requests without one (i.e. fetching an
+// OAuth2 token) get Go's default behavior
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	policy, ok := request.Context().Value(redirectPolicyKey{}).(*redirectPolicy)
+	if ok && request.Response != nil {
+		policy.locations = append(policy.locations, request.Response.Header.Get("Location"))
+	}
+	if ok && !policy.follow {
+		// The redirect response itself is evaluated, so its Location header can be matched
+		return http.ErrUseLastResponse
+	}
+
+	// Redirects leaving -redirect-scope aren't followed, so fuzzed requests never reach another host, and the
+	// redirect response is evaluated instead
+	if ok && !isRedirectInScope(policy.scope, via[0].URL, request.URL) {
+		if opts.Debug {
+			printRed(os.Stderr, "not following redirect from %v to %v, as it leaves -redirect-scope %v\n", via[len(via)-1].URL, request.URL, policy.scope)
+		}
+		policy.outOfScope = true
+		return http.ErrUseLastResponse
+	}
+
+	if !ok || policy.maxRedirects == 0 {
+		if len(via) >= defaultMaxRedirects {
+			return errors.New(fmt.Sprintf("stopped after %v redirects", defaultMaxRedirects))
+		}
+	} else if len(via) > policy.maxRedirects {
+		return http.ErrUseLastResponse
+	}
+
+	if ok {
+		policy.redirects = len(via)
+	}
+	return nil
+}
+
+func validateRedirects(ruleData Rule) error {
+	if ruleData.MaxRedirects < 0 {
+		return errors.New(fmt.Sprintf("maxRedirects: must be at least 1, got %v", ruleData.MaxRedirects))
+	}
+	if ruleData.MaxRedirects > 0 && ruleData.FollowRedirects != nil && !*ruleData.FollowRedirects {
+		return errors.New("maxRedirects: can't be used with followRedirects: false")
+	}
+	return nil
+}
+
+// Where the response redirected to (if it wasn't followed), or how it got to the final URL (if it was), for findings
+func describeRedirects(resp Response) string {
+	var redirects []string
+	if resp.Redirects > 0 {
+		hops := "redirects"
+		if resp.Redirects == 1 {
+			hops = "redirect"
+		}
+		redirect := fmt.Sprintf("%v after %v %v", fullyDecode(resp.FinalUrl), resp.Redirects, hops)
+		// The route taken is only worth showing when there was more than one hop
+		if resp.Redirects > 1 {
+			redirect = fmt.Sprintf("%v via %v", redirect, strings.Join(resp.RedirectLocations[:resp.Redirects], " -> "))
+		}
+		redirects = append(redirects, redirect)
+	}
+	// Either redirects weren't followed, or maxRedirects or -redirect-scope stopped following them
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location := resp.Headers.Get("Location"); location != "" {
+			redirect := "redirects to " + location
+			if resp.RedirectOutOfScope {
+				redirect = fmt.Sprintf("%v (outside -redirect-scope %v)", redirect, opts.RedirectScope)
+			}
+			redirects = append(redirects, redirect)
+		}
+	}
+	return strings.Join(redirects, ", ")
+}
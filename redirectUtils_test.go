@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestIsRedirectInScope(t *testing.T) {
+	tests := []struct {
+		scope  string
+		origin string
+		target string
+		want   bool
+	}{
+		{redirectScopeSameHost, "http://example.com/a", "http://example.com/b", true},
+		{redirectScopeSameHost, "http://example.com/a", "https://example.com/b", true},
+		{redirectScopeSameHost, "http://example.com/a", "http://EXAMPLE.com:80/b", true},
+		{redirectScopeSameHost, "http://example.com/a", "http://example.com:8080/b", false},
+		{redirectScopeSameHost, "http://example.com/a", "http://www.example.com/b", false},
+		{redirectScopeSameDomain, "http://example.com/a", "https://www.EXAMPLE.com/b", true},
+		{redirectScopeSameDomain, "http://a.example.co.uk/", "http://b.example.co.uk/", true},
+		{redirectScopeSameDomain, "http://example.co.uk/", "http://other.co.uk/", false},
+		{redirectScopeSameDomain, "http://example.com/a", "http://evil.com/?example.com", false},
+		{redirectScopeSameDomain, "http://127.0.0.1/", "http://127.0.0.2/", false},
+		{redirectScopeAny, "http://example.com/a", "http://evil.com/", true},
+	}
+
+	for _, test := range tests {
+		origin, _ := url.Parse(test.origin)
+		target, _ := url.Parse(test.target)
+		if got := isRedirectInScope(test.scope, origin, target); got != test.want {
+			t.Errorf("isRedirectInScope(%v, %q, %q) = %v, want %v", test.scope, test.origin, test.target, got, test.want)
+		}
+	}
+}
+
+// A redirect from the last request in via to target, with that request's policy
+func newRedirect(t *testing.T, policy *redirectPolicy, target string, via ...string) (*http.Request, []*http.Request) {
+	t.Helper()
+	var requests []*http.Request
+	for _, rawUrl := range via {
+		request, err := http.NewRequest("GET", rawUrl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, request)
+	}
+
+	request, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != nil {
+		request = withRedirectPolicy(request, policy)
+	}
+	request.Response = &http.Response{StatusCode: 302, Header: http.Header{"Location": {target}}}
+	return request, requests
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     *redirectPolicy
+		target     string
+		via        []string
+		wantErr    error
+		redirects  int
+		outOfScope bool
+	}{
+		{
+			name:   "not followed",
+			policy: &redirectPolicy{follow: false, scope: redirectScopeAny},
+			target: "http://example.com/b",
+			via:    []string{"http://example.com/a"},
+			// The redirect response is evaluated instead
+			wantErr: http.ErrUseLastResponse,
+		},
+		{
+			name:      "followed in scope",
+			policy:    &redirectPolicy{follow: true, scope: redirectScopeSameHost},
+			target:    "http://example.com/c",
+			via:       []string{"http://example.com/a", "http://example.com/b"},
+			redirects: 2,
+		},
+		{
+			name:       "out of scope",
+			policy:     &redirectPolicy{follow: true, scope: redirectScopeSameHost},
+			target:     "http://evil.com/",
+			via:        []string{"http://example.com/a"},
+			wantErr:    http.ErrUseLastResponse,
+			outOfScope: true,
+		},
+		{
+			name:   "scope is checked against the first request",
+			policy: &redirectPolicy{follow: true, scope: redirectScopeSameDomain},
+			target: "http://evil.com/b",
+			// The second hop is in evil.com's domain, but not the original one
+			via:        []string{"http://example.com/a", "http://www.evil.com/a"},
+			wantErr:    http.ErrUseLastResponse,
+			outOfScope: true,
+		},
+		{
+			name:      "within maxRedirects",
+			policy:    &redirectPolicy{follow: true, maxRedirects: 2, scope: redirectScopeAny},
+			target:    "http://example.com/c",
+			via:       []string{"http://example.com/a", "http://example.com/b"},
+			redirects: 2,
+		},
+		{
+			name:    "past maxRedirects",
+			policy:  &redirectPolicy{follow: true, maxRedirects: 2, scope: redirectScopeAny},
+			target:  "http://example.com/d",
+			via:     []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"},
+			wantErr: http.ErrUseLastResponse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, via := newRedirect(t, test.policy, test.target, test.via...)
+			if err := checkRedirect(request, via); err != test.wantErr {
+				t.Errorf("checkRedirect = %v, want %v", err, test.wantErr)
+			}
+			if test.policy.redirects != test.redirects || test.policy.outOfScope != test.outOfScope {
+				t.Errorf("policy has %v redirects, out of scope %v, want %v, %v", test.policy.redirects, test.policy.outOfScope, test.redirects, test.outOfScope)
+			}
+			if len(test.policy.locations) != 1 || test.policy.locations[0] != test.target {
+				t.Errorf("policy has locations %v, want [%v]", test.policy.locations, test.target)
+			}
+		})
+	}
+}
+
+// Too many redirects fail the request when neither the rule nor -max-redirects set a limit, like Go's default
+func TestCheckRedirectDefaultLimit(t *testing.T) {
+	via := make([]string, defaultMaxRedirects)
+	for i := range via {
+		via[i] = "http://example.com/"
+	}
+
+	for _, policy := range []*redirectPolicy{nil, {follow: true, scope: redirectScopeAny}} {
+		request, requests := newRedirect(t, policy, "http://example.com/", via...)
+		if err := checkRedirect(request, requests); err == nil || err == http.ErrUseLastResponse {
+			t.Errorf("checkRedirect after %v redirects = %v, want an error", defaultMaxRedirects, err)
+		}
+		request, requests = newRedirect(t, policy, "http://example.com/", via[1:]...)
+		if err := checkRedirect(request, requests); err != nil {
+			t.Errorf("checkRedirect after %v redirects = %v, want nil", defaultMaxRedirects-1, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+const (
+	reflectedRaw     = "raw"
+	reflectedEncoded = "encoded"
+	reflectedAny     = "any"
+)
+
+// A form the payload could be reflected in, named for findings
+type reflectedForm struct {
+	name  string
+	value string
+}
+
+func validateReflected(mode string) error {
+	switch strings.ToLower(mode) {
+	case "", reflectedRaw, reflectedEncoded, reflectedAny:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("invalid reflected mode %q (must be %v, %v or %v)", mode, reflectedRaw, reflectedEncoded, reflectedAny))
+}
+
+// The encoded forms of a payload that differ from the payload itself, as encoding a payload without any special
+// characters (i.e. a plain marker) doesn't change it
+func getEncodedForms(payload string) []reflectedForm {
+	candidates := []reflectedForm{
+		{name: "HTML encoded", value: html.EscapeString(payload)},
+		// Named and hex entities for quotes are just as common as the decimal ones Go uses
+		{name: "HTML encoded", value: strings.NewReplacer("&#34;", "&quot;", "&#39;", "&#x27;").Replace(html.EscapeString(payload))},
+		{name: "URL encoded", value: url.QueryEscape(payload)},
+		{name: "URL encoded", value: url.PathEscape(payload)},
+	}
+
+	seen := map[string]bool{payload: true}
+	var forms []reflectedForm
+	for _, form := range candidates {
+		if seen[form.value] {
+			continue
+		}
+		seen[form.value] = true
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+// Look for the payloads this request sent in the response body, as-is (raw), HTML or URL encoded (encoded), or either
+// (any), returning which form was found. Raw reflection is checked first, as it's what matters for XSS. The body should
+// already be lowercased if ignoring case
+func matchReflected(body string, payloads []string, mode string, ignoreCase bool) (string, bool) {
+	mode = strings.ToLower(mode)
+	for _, payload := range payloads {
+		if payload == "" {
+			continue
+		}
+
+		var forms []reflectedForm
+		if mode == reflectedRaw || mode == reflectedAny {
+			forms = append(forms, reflectedForm{name: "raw", value: payload})
+		}
+		if mode == reflectedEncoded || mode == reflectedAny {
+			forms = append(forms, getEncodedForms(payload)...)
+		}
+
+		for _, form := range forms {
+			value := form.value
+			if ignoreCase {
+				value = strings.ToLower(value)
+			}
+			if strings.Contains(body, value) {
+				return fmt.Sprintf("reflected %v %q", form.name, form.value), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Backoff between retries doubles each time, up to this long
+const maxRetryBackoff = 30 * time.Second
+
+// Parsed from -retry-on-status
+var retryStatusCodes []codeRange
+
+// How many retries were sent, for the summary. Requests that succeed after retrying are still only counted once in
+// the requests sent. Incremented by the workers, so it's only accessed atomically
+var retriesSent int64
+
+// Parse -retry-on-status, i.e. 502,503,504 or 500-599
+func parseRetryStatusCodes(codes string) ([]codeRange, error) {
+	var ranges []codeRange
+	for _, code := range strings.Split(codes, ",") {
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+		parsed, err := parseCodeRanges([]string{code})
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("retry-on-status flag: invalid status %q (must be a code or range between 100 and 599, i.e. 502 or 500-599)", strings.TrimSpace(code)))
+		}
+		ranges = append(ranges, parsed...)
+	}
+	return ranges, nil
+}
+
+// How many times to resend the rule's failed requests: its own retries if it sets them (including 0, to never retry
+// a rule's requests whatever -retries is), or -retries
+func (r Rule) getRetries() int {
+	if r.Retries != nil {
+		return *r.Retries
+	}
+	return opts.Retries
+}
+
+// Whether a request should be sent again: it failed without a response (other than failing TLS verification, which
+// will only fail again), or responded with one of the -retry-on-status codes
+func shouldRetry(resp Response, err error) bool {
+	if err != nil {
+		return !isTlsVerificationError(err)
+	}
+	for _, codes := range retryStatusCodes {
+		if codes.contains(resp.StatusCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// The wait before a retry, which is -retry-backoff doubled for each retry so far, with jitter of up to half of it so
+// requests that failed together (i.e. when a host blipped) don't all retry at once
+func getRetryBackoff(retry int) time.Duration {
+	if opts.RetryBackoff <= 0 {
+		return 0
+	}
+
+	backoff := time.Duration(opts.RetryBackoff * float64(time.Second))
+	for i := 1; i < retry && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
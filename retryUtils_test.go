@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPointer(value int) *int {
+	return &value
+}
+
+// A rule's own retries take precedence over -retries, including 0 to keep the rule from retrying
+func TestGetRetries(t *testing.T) {
+	original := opts.Retries
+	opts.Retries = 3
+	t.Cleanup(func() { opts.Retries = original })
+
+	tests := []struct {
+		name string
+		rule Rule
+		want int
+	}{
+		{"unset", Rule{}, 3},
+		{"more than -retries", Rule{Retries: intPointer(5)}, 5},
+		{"fewer than -retries", Rule{Retries: intPointer(1)}, 1},
+		{"opted out", Rule{Retries: intPointer(0)}, 0},
+	}
+
+	for _, test := range tests {
+		if got := test.rule.getRetries(); got != test.want {
+			t.Errorf("%v: getRetries() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryStatusCodes(t *testing.T) {
+	tests := []struct {
+		codes string
+		want  []codeRange
+		err   string
+	}{
+		{"", nil, ""},
+		{"502,503,504", []codeRange{{502, 502}, {503, 503}, {504, 504}}, ""},
+		{"500-599", []codeRange{{500, 599}}, ""},
+		{" 429 , ,500-504 ", []codeRange{{429, 429}, {500, 504}}, ""},
+		{"502,abc", nil, `invalid status "abc"`},
+		{"700", nil, `invalid status "700"`},
+	}
+
+	for _, test := range tests {
+		got, err := parseRetryStatusCodes(test.codes)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseRetryStatusCodes(%q) = %v, want an error containing %q", test.codes, err, test.err)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("parseRetryStatusCodes(%q) = %v, %v, want %v", test.codes, got, err, test.want)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	original := retryStatusCodes
+	retryStatusCodes = []codeRange{{502, 504}}
+	t.Cleanup(func() { retryStatusCodes = original })
+
+	tests := []struct {
+		name string
+		resp Response
+		err  error
+		want bool
+	}{
+		{"timed out", Response{}, errors.New("context deadline exceeded"), true},
+		{"failed TLS verification", Response{}, fmt.Errorf("Get: %w", x509.UnknownAuthorityError{}), false},
+		{"retried status", Response{StatusCode: 503}, nil, true},
+		{"other status", Response{StatusCode: 500}, nil, false},
+		{"ok", Response{StatusCode: 200}, nil, false},
+	}
+
+	for _, test := range tests {
+		if got := shouldRetry(test.resp, test.err); got != test.want {
+			t.Errorf("%v: shouldRetry = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Each retry waits -retry-backoff doubled for every retry before it, up to maxRetryBackoff, less up to half of it
+// for jitter
+func TestGetRetryBackoff(t *testing.T) {
+	original := opts.RetryBackoff
+	t.Cleanup(func() { opts.RetryBackoff = original })
+
+	tests := []struct {
+		backoff float64
+		retry   int
+		max     time.Duration
+	}{
+		{0, 1, 0},
+		{1, 1, time.Second},
+		{1, 2, 2 * time.Second},
+		{1, 3, 4 * time.Second},
+		{0.5, 2, time.Second},
+		{1, 10, maxRetryBackoff},
+		{60, 1, maxRetryBackoff},
+	}
+
+	for _, test := range tests {
+		opts.RetryBackoff = test.backoff
+		for i := 0; i < 20; i++ {
+			if got := getRetryBackoff(test.retry); got < test.max/2 || got > test.max {
+				t.Errorf("getRetryBackoff(%v) with -retry-backoff %v = %v, want between %v and %v", test.retry, test.backoff, got, test.max/2, test.max)
+				break
+			}
+		}
+	}
+}
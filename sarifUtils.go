@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// GitHub code scanning ranks findings by a rule's security-severity, a CVSS-like score from 0 to 10
+var sarifSecuritySeverities = map[string]string{
+	severityInfo:     "0.0",
+	severityLow:      "3.0",
+	severityMedium:   "5.5",
+	severityHigh:     "8.0",
+	severityCritical: "9.5",
+}
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string          `json:"id"`
+	ShortDescription sarifMessage    `json:"shortDescription"`
+	Properties       sarifProperties `json:"properties"`
+}
+
+type sarifProperties struct {
+	Tags             []string `json:"tags,omitempty"`
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	// Extracted values, keyed by extractor name, and the -context around what was matched
+	Properties *sarifResultProperties `json:"properties,omitempty"`
+}
+
+type sarifResultProperties struct {
+	Extracted map[string]string `json:"extracted,omitempty"`
+	Context   map[string]string `json:"context,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+// Write every match so far to path as a SARIF report, with a SARIF rule for each loaded rule and each match as a
+// result located at its injected URL, described in full like Slack messages
+func writeSarifReport(path string, rules map[string]Rule) error {
+	evaluationResultsMutex.Lock()
+	results := make([]EvaluationResult, len(evaluationResults))
+	copy(results, evaluationResults)
+	evaluationResultsMutex.Unlock()
+
+	sarifRules := make([]sarifRule, 0, len(rules))
+	ruleIndexes := make(map[string]int)
+	addRule := func(rule string, ruleData Rule) {
+		description := ruleData.Description
+		if description == "" {
+			description = rule
+		}
+		ruleIndexes[rule] = len(sarifRules)
+		sarifRules = append(sarifRules, sarifRule{
+			Id:               rule,
+			ShortDescription: sarifMessage{Text: description},
+			Properties: sarifProperties{
+				Tags:             ruleData.Tags,
+				SecuritySeverity: sarifSecuritySeverities[ruleData.Severity],
+			},
+		})
+	}
+	for _, rule := range getSortedRuleNames(rules) {
+		addRule(rule, rules[rule])
+	}
+
+	sarifResults := make([]sarifResult, 0, len(results))
+	for _, result := range results {
+		// Rules removed by a -watch reload still need a definition for their earlier matches
+		if _, exists := ruleIndexes[result.RuleName]; !exists {
+			addRule(result.RuleName, Rule{Description: result.RuleDescription, Severity: result.Severity})
+		}
+
+		var properties *sarifResultProperties
+		if len(result.Extracted) > 0 || len(result.Context) > 0 {
+			properties = &sarifResultProperties{}
+		}
+		if len(result.Extracted) > 0 {
+			properties.Extracted = make(map[string]string)
+			for _, value := range result.Extracted {
+				properties.Extracted[value.Name] = value.Value
+			}
+		}
+		if len(result.Context) > 0 {
+			properties.Context = make(map[string]string)
+			for _, context := range result.Context {
+				properties.Context[context.Matcher] = context.Context
+			}
+		}
+
+		sarifResults = append(sarifResults, sarifResult{
+			RuleId:    result.RuleName,
+			RuleIndex: ruleIndexes[result.RuleName],
+			Level:     getSarifLevel(result.Severity),
+			Message:   sarifMessage{Text: strings.TrimSpace(formatFindingDetails(result.Match, result))},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{Uri: result.InjectedUrl},
+				},
+			}},
+			Properties: properties,
+		})
+	}
+
+	report := sarifReport{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "qsfuzz",
+				InformationUri: "https://github.com/ameenmaali/qsfuzz",
+				Rules:          sarifRules,
+			}},
+			Results: sarifResults,
+		}},
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(encoded, '\n'), 0644)
+}
+
+// Rules without a severity are warnings, as a match is still worth looking at
+func getSarifLevel(severity string) string {
+	switch severity {
+	case severityCritical, severityHigh:
+		return "error"
+	case severityLow, severityInfo:
+		return "note"
+	}
+	return "warning"
+}
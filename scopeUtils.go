@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Compiled from -scope-regex and -exclude-regex
+var scopeRegex, excludeRegex *regexp.Regexp
+
+func compileScopeRegex(pattern string, name string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%v flag is not a valid regex: %v", name, err))
+	}
+	return compiled, nil
+}
+
+// Split a comma separated list of hostnames or wildcard patterns (i.e. *.example.com), checking each pattern is valid
+func parseHostPatterns(hosts string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(hosts, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid host pattern %v: %v", pattern, err))
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func matchesHostPattern(hostname string, patterns []string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, hostname); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Check a hostname against -include-hosts and -exclude-hosts. Exclusions win if a host matches both
+func isHostInScope(hostname string) bool {
+	if len(includeHosts) > 0 && !matchesHostPattern(hostname, includeHosts) {
+		return false
+	}
+	return !matchesHostPattern(hostname, excludeHosts)
+}
+
+// Check a URL against the host and regex scope flags
+func isInScope(u *url.URL) bool {
+	if !isHostInScope(u.Hostname()) {
+		return false
+	}
+
+	fullUrl := u.String()
+	if scopeRegex != nil && !scopeRegex.MatchString(fullUrl) {
+		return false
+	}
+	return excludeRegex == nil || !excludeRegex.MatchString(fullUrl)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Parsed from -tags and -exclude-tags
+var includeTags, excludeTags []string
+
+// Parsed from -rules and -exclude-rules
+var includeRules, excludeRules []string
+
+// Split a comma separated list of rule names or glob patterns (i.e. sqli-*), checking each pattern is valid
+func parseRulePatterns(rules string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(rules, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid rule pattern %v: %v", pattern, err))
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Rule names are matched case-insensitively, as the config file's keys are lowercased when loaded
+func matchesRulePattern(rule string, pattern string) bool {
+	matched, _ := path.Match(pattern, strings.ToLower(rule))
+	return matched
+}
+
+// Whether a rule should run based on -rules (any of which it needs to match) and -exclude-rules (none of which it can)
+func isNameSelected(rule string) bool {
+	for _, pattern := range excludeRules {
+		if matchesRulePattern(rule, pattern) {
+			return false
+		}
+	}
+	if includeRules == nil {
+		return true
+	}
+	for _, pattern := range includeRules {
+		if matchesRulePattern(rule, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a comma separated list of tags, which are matched case-insensitively
+func parseTagList(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (r Rule) hasTag(tag string) bool {
+	for _, ruleTag := range r.Tags {
+		if strings.EqualFold(ruleTag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a rule should run based on -tags (any of which it needs) and -exclude-tags (none of which it can have)
+func isTagSelected(ruleData Rule) bool {
+	for _, tag := range excludeTags {
+		if ruleData.hasTag(tag) {
+			return false
+		}
+	}
+	if includeTags == nil {
+		return true
+	}
+	for _, tag := range includeTags {
+		if ruleData.hasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drop the rules not selected by -rules, -tags (and their exclude flags) and -only-severity, before any requests are
+// generated. A name or tag that matches no rule is most likely a typo, so it's an error rather than quietly running
+// everything (or nothing)
+func selectRules(c *Config) error {
+	for _, pattern := range append(append([]string(nil), includeRules...), excludeRules...) {
+		found := false
+		for rule := range c.Rules {
+			if matchesRulePattern(rule, pattern) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("no rules match %q (available rules: %v)", pattern, strings.Join(getSortedRuleNames(c.Rules), ", ")))
+		}
+	}
+
+	for _, tag := range append(append([]string(nil), includeTags...), excludeTags...) {
+		found := false
+		for _, ruleData := range c.Rules {
+			if ruleData.hasTag(tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("no rules are tagged %q (tags in use: %v)", tag, strings.Join(getRuleTags(c.Rules), ", ")))
+		}
+	}
+
+	c.totalRules = len(c.Rules)
+	for rule, ruleData := range c.Rules {
+		if !isNameSelected(rule) || !isTagSelected(ruleData) || !isSeveritySelected(ruleData.Severity) {
+			delete(c.Rules, rule)
+		}
+	}
+
+	if len(c.Rules) == 0 && c.totalRules > 0 {
+		return errors.New("no rules are selected by -rules, -exclude-rules, -tags, -exclude-tags and -only-severity")
+	}
+	return nil
+}
+
+// Every tag used by the rules, sorted and lowercased
+func getRuleTags(rules map[string]Rule) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, ruleData := range rules {
+		for _, tag := range ruleData.Tags {
+			tag = strings.ToLower(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
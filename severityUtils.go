@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"strings"
+)
+
+const (
+	severityInfo     = "info"
+	severityLow      = "low"
+	severityMedium   = "medium"
+	severityHigh     = "high"
+	severityCritical = "critical"
+)
+
+// Ordered from least to most severe
+var severities = []string{severityInfo, severityLow, severityMedium, severityHigh, severityCritical}
+
+var severityColors = map[string]func(format string, a ...interface{}){
+	severityInfo:     color.New(color.FgBlue).PrintfFunc(),
+	severityLow:      color.New(color.FgCyan).PrintfFunc(),
+	severityMedium:   color.New(color.FgYellow).PrintfFunc(),
+	severityHigh:     color.New(color.FgRed).PrintfFunc(),
+	severityCritical: color.New(color.FgMagenta, color.Bold).PrintfFunc(),
+}
+
+// Parsed from -min-severity and -only-severity
+var minSeverityLevel int
+var onlySeverities map[string]bool
+
+// The position of a severity in severities, where rules without one count as info. Unknown severities are -1
+func severityLevel(severity string) int {
+	if severity == "" {
+		return 0
+	}
+	for level, known := range severities {
+		if strings.EqualFold(severity, known) {
+			return level
+		}
+	}
+	return -1
+}
+
+func validateSeverity(severity string) error {
+	if severityLevel(severity) < 0 {
+		return errors.New(fmt.Sprintf("invalid severity %q (must be one of %v)", severity, strings.Join(severities, ", ")))
+	}
+	return nil
+}
+
+// Parse a comma separated list of severities, as given to -only-severity
+func parseSeverityList(value string) (map[string]bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed := make(map[string]bool)
+	for _, severity := range strings.Split(value, ",") {
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if err := validateSeverity(severity); err != nil {
+			return nil, err
+		}
+		parsed[severity] = true
+	}
+	return parsed, nil
+}
+
+// Whether a rule should be run at all, based on -only-severity
+func isSeveritySelected(severity string) bool {
+	if onlySeverities == nil {
+		return true
+	}
+	return onlySeverities[severities[severityLevel(severity)]]
+}
+
+// Whether a finding should be reported, based on -min-severity
+func meetsMinSeverity(severity string) bool {
+	return severityLevel(severity) >= minSeverityLevel
+}
+
+// The message for a finding, with the rule's severity after its name when it has one
+func formatMatchMessage(ruleName string, severity string, message string) string {
+	if severity == "" {
+		return fmt.Sprintf("[%s] %s", ruleName, message)
+	}
+	return fmt.Sprintf("[%s] [%s] %s", ruleName, severity, message)
+}
+
+// Print a finding like formatMatchMessage, but with the severity in its own color
+func printMatch(ruleName string, severity string, message string) {
+	if severity == "" {
+		printGreen("[%s] %s", ruleName, message)
+		return
+	}
+	printGreen("[%s] ", ruleName)
+	severityColors[severity]("[%s]", severity)
+	printGreen(" %s", message)
+}
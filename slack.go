@@ -7,12 +7,95 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 )
 
-func sendSlackMessage(message string) error {
+type SlackConfig struct {
+	Channel      string `mapstructure:"channel"`
+	BotToken     string `mapstructure:"botToken"`
+	BotTokenFile string `mapstructure:"botTokenFile"`
+	BotTokenEnv  string `mapstructure:"botTokenEnv"`
+	// Channels for findings of a severity or from rules with a tag, instead of channel
+	SeverityChannels map[string]string `mapstructure:"severityChannels"`
+	TagChannels      map[string]string `mapstructure:"tagChannels"`
+}
+
+// Resolve the bot token from botTokenFile or botTokenEnv if either is set, which take precedence over an inline botToken
+func resolveSlackToken(slack *SlackConfig) error {
+	if slack.BotTokenFile != "" && slack.BotTokenEnv != "" {
+		return errors.New("only one of botTokenFile and botTokenEnv can be set in the Slack config")
+	}
+
+	if slack.BotTokenFile != "" {
+		token, err := ioutil.ReadFile(slack.BotTokenFile)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to read Slack botTokenFile: %v", err))
+		}
+		slack.BotToken = strings.TrimSpace(string(token))
+	}
+
+	if slack.BotTokenEnv != "" {
+		slack.BotToken = strings.TrimSpace(os.Getenv(slack.BotTokenEnv))
+	}
+
+	return nil
+}
+
+// Add the # to channel names that are missing it
+func formatSlackChannel(channel string) string {
+	if !strings.HasPrefix(channel, "#") {
+		return "#" + channel
+	}
+	return channel
+}
+
+// Check the severityChannels and tagChannels mappings, adding the # to their channels like the default channel
+func validateSlackChannels(slack *SlackConfig) error {
+	for severity, channel := range slack.SeverityChannels {
+		if severityLevel(severity) < 0 {
+			return errors.New(fmt.Sprintf("slack severityChannels: invalid severity %q (must be one of %v)", severity, strings.Join(severities, ", ")))
+		}
+		if strings.TrimSpace(channel) == "" {
+			return errors.New(fmt.Sprintf("slack severityChannels: %v needs a channel", severity))
+		}
+		slack.SeverityChannels[severity] = formatSlackChannel(strings.TrimSpace(channel))
+	}
+	for tag, channel := range slack.TagChannels {
+		if strings.TrimSpace(channel) == "" {
+			return errors.New(fmt.Sprintf("slack tagChannels: %v needs a channel", tag))
+		}
+		slack.TagChannels[tag] = formatSlackChannel(strings.TrimSpace(channel))
+	}
+	return nil
+}
+
+// The channel a finding is sent to: the severityChannels entry for its severity (info for rules without one), or else
+// the tagChannels entry for the first of its rule's tags that has one, or else the default channel
+func getSlackChannel(severity string, tags []string) string {
+	if severity == "" {
+		severity = severityInfo
+	}
+	for name, channel := range config.Slack.SeverityChannels {
+		if strings.EqualFold(name, severity) {
+			return channel
+		}
+	}
+	for _, tag := range tags {
+		for name, channel := range config.Slack.TagChannels {
+			if strings.EqualFold(name, tag) {
+				return channel
+			}
+		}
+	}
+	return config.Slack.Channel
+}
+
+// Send a finding to the Slack channel for its severity and rule tags
+func sendSlackMessage(message string, severity string, tags []string) error {
 	slackUrl := "https://slack.com/api/chat.postMessage"
 	content := map[string]interface{}{
-		"channel": config.Slack["channel"],
+		"channel": getSlackChannel(severity, tags),
 		"text":    fmt.Sprintf("```%v```", message),
 	}
 
@@ -27,7 +110,7 @@ func sendSlackMessage(message string) error {
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", config.Slack["bottoken"]))
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", config.Slack.BotToken))
 
 	resp, err := config.httpClient.Do(request)
 	if err != nil {
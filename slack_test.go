@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSlackToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "slack-token")
+	if err := ioutil.WriteFile(tokenFile, []byte("xoxb-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, "QSFUZZ_TEST_SLACK_TOKEN", " xoxb-from-env ")
+	unsetEnv(t, "QSFUZZ_TEST_UNSET")
+
+	tests := []struct {
+		name  string
+		slack SlackConfig
+		want  string
+		err   string
+	}{
+		{"inline", SlackConfig{BotToken: "xoxb-inline"}, "xoxb-inline", ""},
+		{"file", SlackConfig{BotToken: "xoxb-inline", BotTokenFile: tokenFile}, "xoxb-from-file", ""},
+		{"environment", SlackConfig{BotToken: "xoxb-inline", BotTokenEnv: "QSFUZZ_TEST_SLACK_TOKEN"}, "xoxb-from-env", ""},
+		{"unset environment variable", SlackConfig{BotTokenEnv: "QSFUZZ_TEST_UNSET"}, "", ""},
+		{"missing file", SlackConfig{BotTokenFile: filepath.Join(t.TempDir(), "missing")}, "", "unable to read Slack botTokenFile"},
+		{"both", SlackConfig{BotTokenFile: tokenFile, BotTokenEnv: "QSFUZZ_TEST_SLACK_TOKEN"}, "", "only one of botTokenFile and botTokenEnv"},
+	}
+
+	for _, test := range tests {
+		slack := test.slack
+		err := resolveSlackToken(&slack)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%v: resolveSlackToken = %v, want an error containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || slack.BotToken != test.want {
+			t.Errorf("%v: resolveSlackToken = %q, %v, want %q", test.name, slack.BotToken, err, test.want)
+		}
+	}
+}
+
+func TestValidateSlackChannels(t *testing.T) {
+	slack := SlackConfig{
+		SeverityChannels: map[string]string{"critical": "pagers", "high": " #security "},
+		TagChannels:      map[string]string{"xss": "#xss-findings"},
+	}
+	if err := validateSlackChannels(&slack); err != nil {
+		t.Fatal(err)
+	}
+	if slack.SeverityChannels["critical"] != "#pagers" || slack.SeverityChannels["high"] != "#security" || slack.TagChannels["xss"] != "#xss-findings" {
+		t.Errorf("validateSlackChannels = %v and %v, want channels starting with #", slack.SeverityChannels, slack.TagChannels)
+	}
+
+	tests := []struct {
+		slack SlackConfig
+		err   string
+	}{
+		{SlackConfig{SeverityChannels: map[string]string{"urgent": "#a"}}, `invalid severity "urgent"`},
+		{SlackConfig{SeverityChannels: map[string]string{"high": " "}}, "severityChannels: high needs a channel"},
+		{SlackConfig{TagChannels: map[string]string{"sqli": ""}}, "tagChannels: sqli needs a channel"},
+	}
+	for _, test := range tests {
+		if err := validateSlackChannels(&test.slack); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("validateSlackChannels = %v, want an error containing %q", err, test.err)
+		}
+	}
+}
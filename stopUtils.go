@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// The input URLs that have already matched a rule, for -stop-on-first to skip the rest of their requests
+var matchedUrls = make(map[string]bool)
+var matchedUrlsMutex sync.Mutex
+
+// How many queued requests -stop-on-first skipped, for the summary
+var skippedRequests int
+
+func markUrlMatched(targetUrl string) {
+	if !opts.StopOnFirst {
+		return
+	}
+	matchedUrlsMutex.Lock()
+	matchedUrls[targetUrl] = true
+	matchedUrlsMutex.Unlock()
+}
+
+// Whether the task's request can be skipped, as another rule (or payload) already matched its URL. Requests already
+// in flight when the match is found still finish, so a URL can have more than one match
+func shouldSkipTask(t Task) bool {
+	if !opts.StopOnFirst {
+		return false
+	}
+	matchedUrlsMutex.Lock()
+	defer matchedUrlsMutex.Unlock()
+	if matchedUrls[t.TargetUrl] {
+		skippedRequests += 1
+		return true
+	}
+	return false
+}
+
+func hasUrlMatched(targetUrl string) bool {
+	if !opts.StopOnFirst {
+		return false
+	}
+	matchedUrlsMutex.Lock()
+	defer matchedUrlsMutex.Unlock()
+	return matchedUrls[targetUrl]
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// How many hosts to list in the summary
+const summaryTopHosts = 5
+
+type summaryCount struct {
+	name  string
+	count int
+}
+
+// Print an overview of the run to stderr: what was tested, and matches per rule and per host
+func printSummary(urlCount int) {
+	evaluationResultsMutex.Lock()
+	results := make([]EvaluationResult, len(evaluationResults))
+	copy(results, evaluationResults)
+	evaluationResultsMutex.Unlock()
+
+	ruleMatches := make(map[string]int)
+	hostMatches := make(map[string]int)
+	for _, result := range results {
+		ruleMatches[result.RuleName] += 1
+		if u, err := url.Parse(result.InjectedUrl); err == nil {
+			hostMatches[u.Hostname()] += 1
+		}
+	}
+
+	printCyan(os.Stderr, "Summary:\n")
+	// Only worth breaking down when the rules came from more than one place
+	if sourceCounts := getRuleSourceCounts(opts.ConfigFiles, config.ruleSources); len(sourceCounts) > 1 {
+		printCyan(os.Stderr, "  Rules loaded per config file:\n")
+		for _, source := range sourceCounts {
+			printCyan(os.Stderr, "    %v: %v\n", source.name, source.count)
+		}
+	}
+	printCyan(os.Stderr, "  URLs tested: %v\n", urlCount)
+	failed := atomic.LoadInt64(&failedRequestsSent)
+	printCyan(os.Stderr, "  Requests sent: %v (%v failed)\n", atomic.LoadInt64(&successfulRequestsSent)+failed, failed)
+	if retries := atomic.LoadInt64(&retriesSent); retries > 0 {
+		printCyan(os.Stderr, "  Retries sent: %v\n", retries)
+	}
+	if failures := atomic.LoadInt64(&tlsVerificationFailures); failures > 0 && !opts.Insecure && opts.CaCert == "" {
+		printCyan(os.Stderr, "  Requests failed verifying TLS certificates: %v (use -k to skip verification, or -ca-cert to trust their CA)\n", failures)
+	}
+	if scanCheckpoint != nil {
+		printCyan(os.Stderr, "  URL/rule/parameter combinations skipped (-checkpoint): %v\n", scanCheckpoint.skipped)
+	}
+	if opts.StopOnFirst {
+		printCyan(os.Stderr, "  Requests skipped after a match (-stop-on-first): %v\n", skippedRequests)
+	}
+	printCyan(os.Stderr, "  Matches: %v\n", len(results))
+	if len(suppressions) > 0 {
+		printCyan(os.Stderr, "  Matches suppressed (-fp-file): %v\n", getSuppressedCount())
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	printCyan(os.Stderr, "  Matches per rule:\n")
+	for _, rule := range sortSummaryCounts(ruleMatches) {
+		printCyan(os.Stderr, "    %v: %v\n", rule.name, rule.count)
+	}
+
+	printCyan(os.Stderr, "  Top hosts by matches:\n")
+	hosts := sortSummaryCounts(hostMatches)
+	if len(hosts) > summaryTopHosts {
+		hosts = hosts[:summaryTopHosts]
+	}
+	for _, host := range hosts {
+		printCyan(os.Stderr, "    %v: %v\n", host.name, host.count)
+	}
+}
+
+// Highest counts first, then alphabetically so the output is stable
+func sortSummaryCounts(counts map[string]int) []summaryCount {
+	sorted := make([]summaryCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, summaryCount{name: name, count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A known false positive from -fp-file. The rule is a name pattern like -rules, the target either a host pattern like
+// -include-hosts or a URL pattern (anything with a /), and the parameter is optional
+type suppression struct {
+	rule      string
+	host      string
+	urlRegex  *regexp.Regexp
+	param     string
+	line      int
+	rawTarget string
+}
+
+// Loaded from -fp-file
+var suppressions []suppression
+
+// The matches -fp-file suppressed, for the summary and -generate-fp
+var suppressedResults []EvaluationResult
+var suppressedResultsMutex sync.Mutex
+
+// Read a suppression file: one entry per line as "rule target [parameter]", separated by whitespace. Blank lines and
+// lines starting with # are ignored
+func readSuppressions(path string) ([]suppression, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read fp-file: %v", err))
+	}
+	defer file.Close()
+
+	var loaded []suppression
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseSuppression(line)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("fp-file line %v: %v", lineNumber, err))
+		}
+		entry.line = lineNumber
+		loaded = append(loaded, entry)
+	}
+	return loaded, scanner.Err()
+}
+
+func parseSuppression(line string) (suppression, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return suppression{}, errors.New(fmt.Sprintf("%q should be a rule, a host or URL and optionally a parameter", line))
+	}
+
+	entry := suppression{rule: strings.ToLower(fields[0]), rawTarget: fields[1]}
+	if _, err := path.Match(entry.rule, ""); err != nil {
+		return suppression{}, errors.New(fmt.Sprintf("invalid rule pattern %v: %v", fields[0], err))
+	}
+
+	if strings.Contains(fields[1], "/") {
+		entry.urlRegex = compileUrlPattern(fields[1])
+	} else {
+		entry.host = strings.ToLower(fields[1])
+		if _, err := path.Match(entry.host, ""); err != nil {
+			return suppression{}, errors.New(fmt.Sprintf("invalid host pattern %v: %v", fields[1], err))
+		}
+	}
+
+	if len(fields) == 3 {
+		entry.param = fields[2]
+	}
+	return entry, nil
+}
+
+// URL patterns are matched against the injected URL without its query string, with * matching anything (including
+// /), so https://example.com/blog/* covers every page under /blog
+func compileUrlPattern(pattern string) *regexp.Regexp {
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+func (s suppression) matches(result EvaluationResult) bool {
+	if !matchesRulePattern(result.RuleName, s.rule) {
+		return false
+	}
+	if s.param != "" && s.param != "*" && s.param != result.Param {
+		return false
+	}
+
+	u, err := url.Parse(result.InjectedUrl)
+	if err != nil {
+		return false
+	}
+	if s.urlRegex != nil {
+		return s.urlRegex.MatchString(fmt.Sprintf("%v://%v%v", u.Scheme, u.Host, u.EscapedPath()))
+	}
+	return matchesHostPattern(u.Hostname(), []string{s.host})
+}
+
+// Check a match against -fp-file before it's reported. Suppressed matches are kept for the summary and -generate-fp,
+// and are shown with -show-suppressed
+func isSuppressed(result EvaluationResult) bool {
+	for _, entry := range suppressions {
+		if !entry.matches(result) {
+			continue
+		}
+
+		suppressedResultsMutex.Lock()
+		suppressedResults = append(suppressedResults, result)
+		suppressedResultsMutex.Unlock()
+
+		if opts.ShowSuppressed || opts.Debug {
+			printCyan(os.Stderr, "[%v] suppressed match for %v (fp-file line %v: %v)\n", result.RuleName, fullyDecode(result.InjectedUrl), entry.line, entry.rawTarget)
+		}
+		return true
+	}
+	return false
+}
+
+func getSuppressedCount() int {
+	suppressedResultsMutex.Lock()
+	defer suppressedResultsMutex.Unlock()
+	return len(suppressedResults)
+}
+
+// Write the run's findings to path in -fp-file format, one "rule host parameter" entry for each, so they can be
+// reviewed and passed back in with -fp-file. Matches that were already suppressed are included, so the file can be
+// regenerated over the one in use without losing entries
+func writeSuppressionFile(path string) error {
+	evaluationResultsMutex.Lock()
+	results := make([]EvaluationResult, len(evaluationResults))
+	copy(results, evaluationResults)
+	evaluationResultsMutex.Unlock()
+
+	suppressedResultsMutex.Lock()
+	results = append(results, suppressedResults...)
+	suppressedResultsMutex.Unlock()
+
+	seen := make(map[string]bool)
+	var entries []string
+	for _, result := range results {
+		u, err := url.Parse(result.InjectedUrl)
+		if err != nil {
+			continue
+		}
+		entry := fmt.Sprintf("%v %v", strings.ToLower(result.RuleName), strings.ToLower(u.Hostname()))
+		if result.Param != "" {
+			entry = fmt.Sprintf("%v %v", entry, result.Param)
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+
+	var contents strings.Builder
+	contents.WriteString("# qsfuzz false positives: rule, host or URL pattern, and optionally a parameter\n")
+	for _, entry := range entries {
+		contents.WriteString(entry + "\n")
+	}
+	return ioutil.WriteFile(path, []byte(contents.String()), 0644)
+}
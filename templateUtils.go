@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	randomAlphabet      = "abcdefghijklmnopqrstuvwxyz0123456789"
+	defaultRandomLength = 8
+	maxRandomLength     = 1024
+)
+
+// Every template name that gets expanded, with a trailing colon for the ones that take an argument
+var knownTemplates = []string{
+	"fullurl", "domain", "path", "scheme", "port", "hostpath", "rootdomain",
+	"random", "samerandom", "randomstring:", "timestamp", "timestampms", "date:", "oob", "param",
+}
+
+var templateRegex = regexp.MustCompile(`\[\[([^\[\]]+)\]\]`)
+
+// A literal [[ can be written as \[[ (i.e. \[[7*7]]) so it's never treated as a template. It's swapped for this
+// placeholder when the config is loaded, and back to [[ once the payload's templates have all been expanded
+const escapedTemplateOpen = "\uE000"
+
+func escapeTemplates(value string) string {
+	return strings.ReplaceAll(value, `\[[`, escapedTemplateOpen)
+}
+
+func unescapeTemplates(value string) string {
+	return strings.ReplaceAll(value, escapedTemplateOpen, "[[")
+}
+
+func escapeTemplatesInList(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, escapeTemplates(value))
+	}
+	return escaped
+}
+
+func escapeTemplatesInMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	escaped := make(map[string]string)
+	for key, value := range values {
+		escaped[key] = escapeTemplates(value)
+	}
+	return escaped
+}
+
+func escapeExpectation(expectation ExpectedResponse) ExpectedResponse {
+	expectation.Contents = escapeTemplatesInList(expectation.Contents)
+	expectation.Headers = escapeTemplatesInMap(expectation.Headers)
+	expectation.NotContains = escapeTemplatesInList(expectation.NotContains)
+	expectation.JsonPath = escapeTemplatesInMap(expectation.JsonPath)
+	for name, matcher := range expectation.HeaderMatchers {
+		matcher.Contains = escapeTemplates(matcher.Contains)
+		expectation.HeaderMatchers[name] = matcher
+	}
+	return expectation
+}
+
+// Expectations are never expanded per request, so their escaped brackets are restored straight after loading
+func unescapeExpectation(expectation ExpectedResponse) ExpectedResponse {
+	for i, content := range expectation.Contents {
+		expectation.Contents[i] = unescapeTemplates(content)
+	}
+	for header, value := range expectation.Headers {
+		expectation.Headers[header] = unescapeTemplates(value)
+	}
+	for i, content := range expectation.NotContains {
+		expectation.NotContains[i] = unescapeTemplates(content)
+	}
+	for path, condition := range expectation.JsonPath {
+		expectation.JsonPath[path] = unescapeTemplates(condition)
+	}
+	for name, matcher := range expectation.HeaderMatchers {
+		matcher.Contains = unescapeTemplates(matcher.Contains)
+		expectation.HeaderMatchers[name] = matcher
+	}
+	return expectation
+}
+
+// Filters that can be chained onto any template (i.e. [[fullurl|b64|urlencode]]), applied from left to right
+var templateFilters = map[string]func(string) string{
+	"b64":       func(value string) string { return base64.StdEncoding.EncodeToString([]byte(value)) },
+	"b64url":    func(value string) string { return base64.URLEncoding.EncodeToString([]byte(value)) },
+	"md5":       func(value string) string { sum := md5.Sum([]byte(value)); return hex.EncodeToString(sum[:]) },
+	"sha1":      func(value string) string { sum := sha1.Sum([]byte(value)); return hex.EncodeToString(sum[:]) },
+	"sha256":    func(value string) string { sum := sha256.Sum256([]byte(value)); return hex.EncodeToString(sum[:]) },
+	"urlencode": url.QueryEscape,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+}
+
+var templateFilterNames = []string{"b64", "b64url", "md5", "sha1", "sha256", "urlencode", "lower", "upper"}
+
+// Find [[...]] tokens that aren't a known template, so they can be flagged rather than silently sent as-is
+func getUnknownTemplates(injection string) []string {
+	var unknown []string
+	for _, match := range templateRegex.FindAllStringSubmatch(injection, -1) {
+		name, _ := splitTemplateFilters(match[1])
+		if !isKnownTemplate(name) {
+			unknown = append(unknown, match[0])
+		}
+	}
+	return unknown
+}
+
+func isKnownTemplate(name string) bool {
+	for _, known := range knownTemplates {
+		if name == known || (strings.HasSuffix(known, ":") && strings.HasPrefix(name, known)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split a template's contents (i.e. fullurl|b64|urlencode) into its name and filter chain
+func splitTemplateFilters(contents string) (string, []string) {
+	parts := strings.Split(contents, "|")
+	return parts[0], parts[1:]
+}
+
+func validateTemplateFilters(template string, filters []string) error {
+	for _, filter := range filters {
+		if _, exists := templateFilters[filter]; !exists {
+			return errors.New(fmt.Sprintf("invalid filter %q in template %q (must be one of %v)", filter, template, strings.Join(templateFilterNames, ", ")))
+		}
+	}
+	return nil
+}
+
+// Unknown filters are caught when loading the config, so they're skipped here
+func applyTemplateFilters(value string, filters []string) string {
+	for _, filter := range filters {
+		if apply, exists := templateFilters[filter]; exists {
+			value = apply(value)
+		}
+	}
+	return value
+}
+
+// The raw value of a URL based template, before any escaping
+func getUrlTemplateValue(u *url.URL, name string) (string, bool) {
+	switch name {
+	case "fullurl":
+		return u.String(), true
+	case "domain":
+		return u.Hostname(), true
+	case "path":
+		return u.Path, true
+	case "scheme":
+		return u.Scheme, true
+	case "port":
+		return getPort(u), true
+	case "hostpath":
+		return u.Host + u.Path, true
+	case "rootdomain":
+		return getRootDomain(u.Hostname()), true
+	}
+	return "", false
+}
+
+// The URL's explicit port, or the default port for its scheme
+func getPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return getDefaultPort(u.Scheme)
+}
+
+func getDefaultPort(scheme string) string {
+	if strings.EqualFold(scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// The registrable domain (i.e. example.co.uk for api.staging.example.co.uk), based on the public suffix list. Hosts
+// without one, such as IP addresses or localhost, are returned as-is
+func getRootDomain(hostname string) string {
+	// IP addresses don't have a root domain, and the public suffix list would treat part of an IPv4 address as one
+	if net.ParseIP(hostname) != nil {
+		return hostname
+	}
+	rootDomain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
+	}
+	return rootDomain
+}
+
+var wordlistTemplateRegex = regexp.MustCompile(`\[\[wordlist:([^\]]+)\]\]`)
+
+// Expand [[wordlist:file]] templates into one injection per line of the file. Relative paths are resolved from the
+// config file's directory, and each file is only read once
+func expandWordlists(ruleInjections []string, baseDir string, wordlists map[string][]string) ([]string, error) {
+	var expanded []string
+	for _, ruleInjection := range ruleInjections {
+		match := wordlistTemplateRegex.FindStringSubmatchIndex(ruleInjection)
+		if match == nil {
+			expanded = append(expanded, ruleInjection)
+			continue
+		}
+
+		path := ruleInjection[match[2]:match[3]]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		words, exists := wordlists[path]
+		if !exists {
+			var err error
+			words, err = readWordlist(path)
+			if err != nil {
+				return nil, err
+			}
+			wordlists[path] = words
+		}
+
+		var injections []string
+		for _, word := range words {
+			injections = append(injections, ruleInjection[:match[0]]+escapeTemplates(word)+ruleInjection[match[1]:])
+		}
+
+		// Expand again in case the injection references more than one wordlist
+		injections, err := expandWordlists(injections, baseDir, wordlists)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, injections...)
+	}
+	return expanded, nil
+}
+
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read wordlist: %v", err))
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := scanner.Text(); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// Matches the templates that change with every request: [[random]], [[samerandom]], [[randomstring:N]],
+// [[timestamp]], [[timestampms]], [[date:layout]], [[oob]] and [[param]], along with any filters
+var requestTemplateRegex = regexp.MustCompile(`\[\[(random|samerandom|randomstring:[^\]|]*|timestamp|timestampms|date:[^\]|]*|oob|param)((?:\|[^\[\]|]*)*)\]\]`)
+
+// The clock used for time based templates, which can be swapped out to pin the time
+var now = time.Now
+
+// Check the templates within an injection can be expanded, so bad arguments are caught when loading the config. The
+// oob domain is the one from the config being loaded, which isn't in use yet
+func validateTemplates(injection string, oobDomain string) error {
+	if usesOobTemplate(injection) && !opts.Oob && oobDomain == "" {
+		return errors.New("[[oob]] requires either the -oob flag with an oob server, or an oob domain set in the config file")
+	}
+
+	for _, match := range templateRegex.FindAllStringSubmatch(injection, -1) {
+		if _, filters := splitTemplateFilters(match[1]); len(filters) > 0 {
+			if err := validateTemplateFilters(match[0], filters); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, match := range requestTemplateRegex.FindAllStringSubmatch(injection, -1) {
+		name := match[1]
+		switch {
+		case strings.HasPrefix(name, "randomstring:"):
+			if _, ok := parseRandomLength(name); !ok {
+				return errors.New(fmt.Sprintf("invalid length in %v (must be between 1 and %v)", match[0], maxRandomLength))
+			}
+		case strings.HasPrefix(name, "date:"):
+			layout := strings.TrimPrefix(name, "date:")
+			// A layout without any Go reference time elements (i.e. 2006-01-02) formats to itself
+			if layout == "" || time.Unix(0, 0).UTC().Format(layout) == layout {
+				return errors.New(fmt.Sprintf("invalid date layout in %v (must use Go's reference time, i.e. 2006-01-02)", match[0]))
+			}
+		}
+	}
+	return nil
+}
+
+// Random, time and parameter based templates are expanded separately from the URL based ones, once for every
+// generated request, so each request gets its own unique values and the name of the parameter it's injected into
+func expandRequestTemplates(injection string, param string) string {
+	// Most payloads have no templates at all, so skip the regex entirely for those
+	if !strings.Contains(injection, "[[") {
+		return unescapeTemplates(injection)
+	}
+
+	// [[samerandom]] repeats the first random value in the payload, for correlation within a single payload
+	var firstRandom string
+	return unescapeTemplates(requestTemplateRegex.ReplaceAllStringFunc(injection, func(template string) string {
+		name, filters := splitTemplateFilters(strings.TrimSuffix(strings.TrimPrefix(template, "[["), "]]"))
+
+		var value string
+		switch {
+		case name == "timestamp":
+			return applyTemplateFilters(strconv.FormatInt(now().Unix(), 10), filters)
+		case name == "timestampms":
+			return applyTemplateFilters(strconv.FormatInt(now().UnixNano()/int64(time.Millisecond), 10), filters)
+		case strings.HasPrefix(name, "date:"):
+			return applyTemplateFilters(now().Format(strings.TrimPrefix(name, "date:")), filters)
+		case name == "param":
+			return applyTemplateFilters(param, filters)
+		case name == "oob":
+			if oobClient == nil {
+				return template
+			}
+			return applyTemplateFilters(oobClient.newId(), filters)
+		case name == "random":
+			value = randomString(defaultRandomLength)
+		case name == "samerandom":
+			if firstRandom != "" {
+				return applyTemplateFilters(firstRandom, filters)
+			}
+			value = randomString(defaultRandomLength)
+		default:
+			length, ok := parseRandomLength(name)
+			if !ok {
+				if opts.Debug {
+					printRed(os.Stderr, "invalid length in %v template (must be between 1 and %v), leaving it as is\n", template, maxRandomLength)
+				}
+				return template
+			}
+			value = randomString(length)
+		}
+
+		if firstRandom == "" {
+			firstRandom = value
+		}
+		return applyTemplateFilters(value, filters)
+	}))
+}
+
+func parseRandomLength(name string) (int, bool) {
+	length, err := strconv.Atoi(strings.TrimPrefix(name, "randomstring:"))
+	if err != nil || length <= 0 || length > maxRandomLength {
+		return 0, false
+	}
+	return length, true
+}
+
+func randomString(length int) string {
+	value := make([]byte, length)
+	for i := range value {
+		value[i] = randomAlphabet[random.Intn(len(randomAlphabet))]
+	}
+	return string(value)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Pin the clock for time based templates, restoring it when the test finishes
+func pinClock(t *testing.T, pinned time.Time) {
+	t.Helper()
+	original := now
+	now = func() time.Time { return pinned }
+	t.Cleanup(func() { now = original })
+}
+
+func TestExpandTimeTemplates(t *testing.T) {
+	pinClock(t, time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.UTC))
+
+	tests := []struct {
+		injection string
+		want      string
+	}{
+		{"[[timestamp]]", "1614834367"},
+		{"[[timestampms]]", "1614834367890"},
+		{"[[date:2006-01-02]]", "2021-03-04"},
+		{"[[date:2006-01-02T15:04:05Z07:00]]", "2021-03-04T05:06:07Z"},
+		{"[[date:Jan 2 15:04]]", "Mar 4 05:06"},
+		{"sig=[[timestamp]]&at=[[date:15:04:05.000]]", "sig=1614834367&at=05:06:07.890"},
+		{"[[timestamp|md5]]", "c4b1a202fe87ee478ceca8dec5737183"},
+		{"[[date:2006/01/02|urlencode]]", "2021%2F03%2F04"},
+	}
+
+	for _, test := range tests {
+		if got := expandRequestTemplates(test.injection, "q"); got != test.want {
+			t.Errorf("expandRequestTemplates(%q) = %q, want %q", test.injection, got, test.want)
+		}
+	}
+}
+
+// Each request gets the time it was generated at, rather than one fixed when the config was loaded
+func TestExpandTimeTemplatesFollowClock(t *testing.T) {
+	pinClock(t, time.Unix(1000, 0))
+	first := expandRequestTemplates("[[timestamp]]", "q")
+	pinClock(t, time.Unix(2000, 0))
+	second := expandRequestTemplates("[[timestamp]]", "q")
+
+	if first != "1000" || second != "2000" {
+		t.Errorf("got timestamps %q and %q, want 1000 and 2000", first, second)
+	}
+}
+
+func TestValidateTimeTemplates(t *testing.T) {
+	tests := []struct {
+		injection string
+		err       string
+	}{
+		{"[[timestamp]]", ""},
+		{"[[timestampms|b64]]", ""},
+		{"[[date:2006-01-02]]", ""},
+		{"[[date:15:04]]", ""},
+		{"[[date:]]", "invalid date layout in [[date:]]"},
+		{"[[date:yyyy-mm-dd]]", "invalid date layout in [[date:yyyy-mm-dd]]"},
+		{"x=[[date:today]]", "invalid date layout in [[date:today]]"},
+		{"[[timestamp|nope]]", "invalid filter \"nope\""},
+	}
+
+	for _, test := range tests {
+		err := validateTemplates(test.injection, "")
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("validateTemplates(%q) = %v, want no error", test.injection, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("validateTemplates(%q) = %v, want an error containing %q", test.injection, err, test.err)
+		}
+	}
+}
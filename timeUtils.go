@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Delays need to fit within the request timeout, otherwise the slow responses they look for would never arrive
+func validateDelayExpectation(expectation ExpectedResponse, timeoutSeconds int) error {
+	if expectation.MinDelaySeconds < 0 || expectation.DelayConfirmations < 0 {
+		return errors.New("minDelaySeconds and delayConfirmations can't be negative")
+	}
+	if expectation.MinDelaySeconds == 0 && (expectation.RelativeToBaseline || expectation.DelayConfirmations > 0) {
+		return errors.New("relativeToBaseline and delayConfirmations require minDelaySeconds to be set")
+	}
+	if expectation.MinDelaySeconds >= float64(timeoutSeconds) {
+		return errors.New(fmt.Sprintf("minDelaySeconds (%v) must be less than the request timeout (%v seconds, from timeoutSeconds or -t)", expectation.MinDelaySeconds, timeoutSeconds))
+	}
+	return nil
+}
+
+// Check the response took at least minDelaySeconds (longer than the baseline if relativeToBaseline is set), then
+// resend the request delayConfirmations times, all of which need to be as slow, to rule out a slow network
+func matchesDelay(resp Response, t Task, expectation ExpectedResponse) (string, bool) {
+	threshold := time.Duration(expectation.MinDelaySeconds * float64(time.Second))
+
+	var baseline time.Duration
+	if expectation.RelativeToBaseline {
+		baselineResp, err := getBaselineResponse(t)
+		if err != nil {
+			return "", false
+		}
+		baseline = baselineResp.Duration
+		threshold += baseline
+	}
+
+	if resp.Duration < threshold {
+		return "", false
+	}
+
+	for i := 0; i < expectation.DelayConfirmations; i++ {
+		confirmation, err := sendRequest(t)
+		if err != nil || confirmation.Duration < threshold {
+			return "", false
+		}
+	}
+
+	detail := fmt.Sprintf("response took %v", resp.Duration.Round(time.Millisecond))
+	if expectation.RelativeToBaseline {
+		detail = fmt.Sprintf("%v, baseline %v", detail, baseline.Round(time.Millisecond))
+	}
+	return detail, true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// How many requests failed because the target's certificate couldn't be verified, for the summary to point out -k
+// and -ca-cert. Incremented by the workers, so it's only accessed atomically
+var tlsVerificationFailures int64
+
+// Build the TLS config every request uses. Certificates are verified against the system's roots, along with those
+// in the -ca-cert bundle (i.e. a corporate MITM proxy's CA), unless -k skips verification entirely
+func getTlsConfig(insecure bool, caCertFile string) (*tls.Config, error) {
+	if insecure {
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	if caCertFile == "" {
+		return &tls.Config{}, nil
+	}
+
+	bundle, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read ca-cert: %v", err))
+	}
+
+	// The bundle is trusted on top of the system's roots, rather than instead of them
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, errors.New(fmt.Sprintf("ca-cert %v has no PEM encoded certificates", caCertFile))
+	}
+	return &tls.Config{RootCAs: roots}, nil
+}
+
+// Whether a request failed because the server's certificate didn't verify (i.e. it's self-signed, expired or for
+// another hostname), rather than the connection failing
+func isTlsVerificationError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+}
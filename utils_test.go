@@ -0,0 +1,325 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodeQueryStringsInOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   url.Values
+		original string
+		decode   bool
+		want     string
+	}{
+		{"repeated keys", url.Values{"a": {"1", "2"}}, "a=1&a=2", false, "a=1&a=2"},
+		{"repeated keys interleaved", url.Values{"a": {"1", "2"}, "b": {"x"}}, "a=1&b=x&a=2", false, "a=1&b=x&a=2"},
+		{"first occurrence injected", url.Values{"a": {"<p>", "2"}, "b": {"x"}}, "a=1&b=x&a=2", false, "a=%3Cp%3E&b=x&a=2"},
+		{"second occurrence injected", url.Values{"a": {"1", "<p>"}, "b": {"x"}}, "a=1&b=x&a=2", false, "a=1&b=x&a=%3Cp%3E"},
+		{"decoded", url.Values{"a": {"1", "<p>"}, "b": {"x"}}, "a=1&b=x&a=2", true, "a=1&b=x&a=<p>"},
+		{"not sorted", url.Values{"z": {"1"}, "a": {"2"}}, "z=1&a=2", false, "z=1&a=2"},
+		{"encoded keys", url.Values{"a b": {"1", "2"}}, "a%20b=1&a+b=2", false, "a+b=1&a+b=2"},
+		{"added values go last", url.Values{"a": {"1", "2", "3"}, "b": {"x"}, "c[]": {"y"}}, "a=1&b=x&a=2", false, "a=1&b=x&a=2&a=3&c%5B%5D=y"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := encodeQueryStringsInOrder(test.values, test.original, test.decode); got != test.want {
+				t.Errorf("encodeQueryStringsInOrder = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// Set -preserve-order for the test, restoring it when the test finishes
+func setPreserveOrder(t *testing.T, preserveOrder bool) {
+	t.Helper()
+	original := opts.PreserveOrder
+	opts.PreserveOrder = preserveOrder
+	t.Cleanup(func() { opts.PreserveOrder = original })
+}
+
+// Each occurrence of a repeated parameter is injected on its own, with the others left as they were
+func TestGetInjectedUrlsRepeatedKeys(t *testing.T) {
+	type injected struct {
+		query    string
+		location string
+	}
+	tests := []struct {
+		name          string
+		query         string
+		preserveOrder bool
+		want          []injected
+	}{
+		{
+			name:  "sorted",
+			query: "a=1&a=2",
+			want: []injected{
+				{"a=P&a=2", "a, occurrence 1 of 2"},
+				{"a=1&a=P", "a, occurrence 2 of 2"},
+			},
+		},
+		{
+			name:  "sorted with another parameter between them",
+			query: "a=1&b=x&a=2",
+			want: []injected{
+				{"a=P&a=2&b=x", "a, occurrence 1 of 2"},
+				{"a=1&a=P&b=x", "a, occurrence 2 of 2"},
+				{"a=1&a=2&b=P", ""},
+			},
+		},
+		{
+			name:          "in order",
+			query:         "a=1&a=2",
+			preserveOrder: true,
+			want: []injected{
+				{"a=P&a=2", "a, occurrence 1 of 2"},
+				{"a=1&a=P", "a, occurrence 2 of 2"},
+			},
+		},
+		{
+			name:          "in order with another parameter between them",
+			query:         "a=1&b=x&a=2",
+			preserveOrder: true,
+			want: []injected{
+				{"a=P&b=x&a=2", "a, occurrence 1 of 2"},
+				{"a=1&b=x&a=P", "a, occurrence 2 of 2"},
+				{"a=1&b=P&a=2", ""},
+			},
+		},
+		{
+			name:          "three occurrences with empty values",
+			query:         "a=&a=2&a=",
+			preserveOrder: true,
+			want: []injected{
+				{"a=P&a=2&a=", "a, occurrence 1 of 3"},
+				{"a=&a=P&a=", "a, occurrence 2 of 3"},
+				{"a=&a=2&a=P", "a, occurrence 3 of 3"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setPreserveOrder(t, test.preserveOrder)
+			u, err := url.Parse("https://example.com/?" + test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			injections, err := getInjectedUrls(u, []string{"P"}, false, false, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(injections) != len(test.want) {
+				t.Fatalf("got %v injections, want %v: %v", len(injections), len(test.want), injections)
+			}
+			for i, injection := range injections {
+				want := "https://example.com/?" + test.want[i].query
+				if injection.Url != want || injection.Location != test.want[i].location {
+					t.Errorf("injection %v = %q at %q, want %q at %q", i, injection.Url, injection.Location, want, test.want[i].location)
+				}
+			}
+		})
+	}
+}
+
+func TestGetInjectedRawUrlsRepeatedKeys(t *testing.T) {
+	u, err := url.Parse("https://example.com/?a=1&b=x&a=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		url      string
+		location string
+	}{
+		{"https://example.com/?a=<P>&b=x&a=2", "a, occurrence 1 of 2"},
+		{"https://example.com/?a=1&b=<P>&a=2", ""},
+		{"https://example.com/?a=1&b=x&a=<P>", "a, occurrence 2 of 2"},
+	}
+
+	injections := getInjectedRawUrls(u, []string{"<P>"})
+	if len(injections) != len(want) {
+		t.Fatalf("got %v injections, want %v: %v", len(injections), len(want), injections)
+	}
+	for i, injection := range injections {
+		if injection.Url != want[i].url || injection.Location != want[i].location {
+			t.Errorf("injection %v = %q at %q, want %q at %q", i, injection.Url, injection.Location, want[i].url, want[i].location)
+		}
+	}
+}
+
+func TestGetUrlHostIpv6(t *testing.T) {
+	tests := []struct {
+		rawUrl string
+		want   string
+	}{
+		{"http://[::1]:8080/?a=1", "[::1]:8080"},
+		{"http://[::1]/?a=1", "[::1]"},
+		{"http://[2001:db8::1]/", "[2001:db8::1]"},
+		{"https://[2001:DB8::1]:8443/a", "[2001:db8::1]:8443"},
+		{"https://[2001:db8::1]:443/a", "[2001:db8::1]"},
+		{"http://127.0.0.1:8080/", "127.0.0.1:8080"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.rawUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getUrlHost(u); got != test.want {
+			t.Errorf("getUrlHost(%q) = %q, want %q", test.rawUrl, got, test.want)
+		}
+	}
+}
+
+// Injected URLs and URL based templates keep IPv6 hosts bracketed, with their port written once
+func TestIpv6HostsInInjectedUrls(t *testing.T) {
+	tests := []struct {
+		rawUrl   string
+		injected string
+		domain   string
+		hostpath string
+		port     string
+	}{
+		{"http://[::1]:8080/?a=1", "http://[::1]:8080/?a=P", "::1", "[::1]:8080/", "8080"},
+		{"http://[2001:db8::1]/?a=1", "http://[2001:db8::1]/?a=P", "2001:db8::1", "[2001:db8::1]/", "80"},
+		{"https://[2001:db8::1]:8443/x/y?a=1", "https://[2001:db8::1]:8443/x/y?a=P", "2001:db8::1", "[2001:db8::1]:8443/x/y", "8443"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.rawUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		injections, err := getInjectedUrls(u, []string{"P"}, false, false, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(injections) != 1 || injections[0].Url != test.injected {
+			t.Fatalf("getInjectedUrls(%q) = %v, want %q", test.rawUrl, injections, test.injected)
+		}
+		if injected, err := url.Parse(injections[0].Url); err != nil || injected.Host != u.Host {
+			t.Errorf("injected URL %q doesn't keep the host %q", injections[0].Url, u.Host)
+		}
+
+		for template, want := range map[string]string{"[[domain]]": test.domain, "[[hostpath]]": test.hostpath, "[[port]]": test.port, "[[rootdomain]]": test.domain} {
+			if got := expandUrlTemplates(template, u, false); got != want {
+				t.Errorf("%v for %q = %q, want %q", template, test.rawUrl, got, want)
+			}
+		}
+	}
+}
+
+func TestGetUrlHostPorts(t *testing.T) {
+	tests := []struct {
+		rawUrl string
+		want   string
+	}{
+		{"http://example.com/", "example.com"},
+		{"http://example.com:80/", "example.com"},
+		{"http://example.com:8080/", "example.com:8080"},
+		{"https://example.com:443/", "example.com"},
+		{"https://example.com:80/", "example.com:80"},
+		{"http://example.com:443/", "example.com:443"},
+		{"http://EXAMPLE.com:8080/", "example.com:8080"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.rawUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getUrlHost(u); got != test.want {
+			t.Errorf("getUrlHost(%q) = %q, want %q", test.rawUrl, got, test.want)
+		}
+	}
+}
+
+// Services on different ports of a host are separate targets, while a scheme's default port is the same target as
+// leaving it out
+func TestGetUrlsFromFileDedupsPorts(t *testing.T) {
+	input := []string{
+		"http://example.com/?a=1",
+		"http://example.com:80/?a=2",
+		"http://example.com:8080/?a=3",
+		"http://example.com:8080/?a=4",
+		"http://example.com:8443/?a=5",
+		"https://example.com/s?a=6",
+		"https://example.com:443/s?a=7",
+		"https://example.com:80/s?a=8",
+		"http://[::1]:8080/?a=9",
+		"http://[::1]/?a=10",
+		"http://[::1]:80/?a=11",
+	}
+	want := []string{
+		"http://example.com/?a=1",
+		"http://example.com:8080/?a=3",
+		"http://example.com:8443/?a=5",
+		"https://example.com/s?a=6",
+		"https://example.com:80/s?a=8",
+		"http://[::1]:8080/?a=9",
+		"http://[::1]/?a=10",
+	}
+
+	urlFile := filepath.Join(t.TempDir(), "urls.txt")
+	if err := ioutil.WriteFile(urlFile, []byte(strings.Join(input, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := opts.UrlFile
+	opts.UrlFile = urlFile
+	t.Cleanup(func() { opts.UrlFile = original })
+
+	urls, err := getUrlsFromFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(urls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("getUrlsFromFile() = %v, want %v", urls, want)
+	}
+}
+
+// A rule's timeoutSeconds has to be at least a second when it's set, rather than 0 quietly falling back to -t
+func TestValidateRuleTimeoutSeconds(t *testing.T) {
+	original := opts.Timeout
+	opts.Timeout = 15
+	t.Cleanup(func() { opts.Timeout = original })
+
+	tests := []struct {
+		name           string
+		timeoutSeconds *int
+		want           int
+		err            string
+	}{
+		{"unset", nil, 15, ""},
+		{"longer than -t", intPointer(30), 30, ""},
+		{"shorter than -t", intPointer(1), 1, ""},
+		{"zero", intPointer(0), 0, "timeoutSeconds: must be at least 1, got 0"},
+		{"negative", intPointer(-5), 0, "timeoutSeconds: must be at least 1, got -5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := Rule{Injections: []string{"P"}, Expectation: ExpectedResponse{Contents: []string{"P"}}, TimeoutSeconds: test.timeoutSeconds}
+			rule, err := validateRule("test", rule, "")
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("validateRule = %v, want an error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.getTimeoutSeconds(); got != test.want {
+				t.Errorf("getTimeoutSeconds() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Every problem found while loading a config, so they can all be fixed in one go rather than one run at a time
+type configErrors []string
+
+func (e configErrors) Error() string {
+	if len(e) == 1 {
+		return e[0]
+	}
+	return fmt.Sprintf("%v problems found:\n  %v", len(e), strings.Join(e, "\n  "))
+}
+
+// With -lenient, problems are printed as warnings and loading carries on. Otherwise (and always with -validate) they're
+// returned to fail loading the config
+func lenientProblems(problems configErrors, consequence string) configErrors {
+	if !opts.Lenient || opts.Validate {
+		return problems
+	}
+	for _, problem := range problems {
+		printRed(os.Stderr, "warning: %v (%v)\n", problem, consequence)
+	}
+	return nil
+}
+
+// A field a part of the config can be decoded into, named as it's written in the config file
+type configField struct {
+	name      string
+	fieldType reflect.Type
+}
+
+// The fields of a config struct, keyed by their lowercased name, as viper lowercases the config file's keys
+func getConfigFields(t reflect.Type) map[string]configField {
+	fields := make(map[string]configField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Unexported fields hold what's compiled or parsed when loading, and can't be set from the config file
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "" {
+			// Untagged fields are matched case-insensitively, so they're written in the config file's camelCase
+			name = strings.ToLower(field.Name[:1]) + field.Name[1:]
+		}
+		fields[strings.ToLower(name)] = configField{name: name, fieldType: field.Type}
+	}
+	return fields
+}
+
+// Check the raw config against the types it's decoded into, catching unknown keys (i.e. typos, which would otherwise
+// be silently ignored) and values of the wrong shape (i.e. a payload containing ": " parsed as a map), which viper only
+// reports vaguely. Unknown keys aren't fatal, as the rest of the config can still be loaded
+func checkConfigValue(value interface{}, t reflect.Type, path string, unknownKeys *configErrors, invalid *configErrors) {
+	if value == nil {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		checkConfigValue(value, t.Elem(), path, unknownKeys, invalid)
+	case reflect.Struct:
+		values, ok := asConfigMap(value)
+		if !ok {
+			*invalid = append(*invalid, fmt.Sprintf("%v: expected a map of fields, got %v", formatConfigPath(path), describeConfigValue(value)))
+			return
+		}
+
+		fields := getConfigFields(t)
+		for _, key := range getSortedConfigKeys(values) {
+			field, exists := fields[key]
+			if !exists {
+				problem := fmt.Sprintf("%v: unknown key", formatConfigPath(joinConfigPath(path, key)))
+				if suggestion := getClosestConfigField(key, fields); suggestion != "" {
+					problem += fmt.Sprintf(" (did you mean %v?)", suggestion)
+				}
+				*unknownKeys = append(*unknownKeys, problem)
+				continue
+			}
+			checkConfigValue(values[key], field.fieldType, joinConfigPath(path, field.name), unknownKeys, invalid)
+		}
+	case reflect.Map:
+		values, ok := asConfigMap(value)
+		if !ok {
+			*invalid = append(*invalid, fmt.Sprintf("%v: expected a map, got %v", formatConfigPath(path), describeConfigValue(value)))
+			return
+		}
+
+		for _, key := range getSortedConfigKeys(values) {
+			checkConfigValue(values[key], t.Elem(), joinConfigPath(path, key), unknownKeys, invalid)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			// A single value is decoded as a list of one
+			checkConfigValue(value, t.Elem(), path, unknownKeys, invalid)
+			return
+		}
+
+		for i, item := range items {
+			checkConfigValue(item, t.Elem(), fmt.Sprintf("%v[%v]", path, i), unknownKeys, invalid)
+		}
+	default:
+		switch value.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+			*invalid = append(*invalid, fmt.Sprintf("%v: expected a single value, got a map (values containing \": \" need to be quoted)", formatConfigPath(path)))
+		case []interface{}:
+			*invalid = append(*invalid, fmt.Sprintf("%v: expected a single value, got a list", formatConfigPath(path)))
+		}
+	}
+}
+
+// Nested maps within lists aren't converted or lowercased by viper, so they're handled here
+func asConfigMap(value interface{}) (map[string]interface{}, bool) {
+	switch values := value.(type) {
+	case map[string]interface{}:
+		lowered := make(map[string]interface{}, len(values))
+		for key, child := range values {
+			lowered[strings.ToLower(key)] = child
+		}
+		return lowered, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(values))
+		for key, child := range values {
+			converted[strings.ToLower(fmt.Sprint(key))] = child
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+func describeConfigValue(value interface{}) string {
+	switch value.(type) {
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "a map"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
+
+// Paths within a rule are written like the rest of the config's errors, i.e. "rule sqli: expectation.bodyRegex[0]"
+func joinConfigPath(path string, key string) string {
+	switch {
+	case path == "":
+		return key
+	case path == "rules":
+		return "rule " + key + ":"
+	case strings.HasSuffix(path, ":"):
+		return path + " " + key
+	}
+	return path + "." + key
+}
+
+func formatConfigPath(path string) string {
+	return strings.TrimSuffix(path, ":")
+}
+
+func getSortedConfigKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The known field closest to an unknown key, if it's close enough to likely be a typo of it
+func getClosestConfigField(key string, fields map[string]configField) string {
+	closest := ""
+	closestDistance := len(key)/3 + 1
+	for name, field := range fields {
+		distance := getEditDistance(key, name)
+		if distance < closestDistance || (distance == closestDistance && closest != "" && field.name < closest) {
+			closest = field.name
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+// The Levenshtein distance between two strings
+func getEditDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Matches [[var:name]] and the shorthand [[name]], along with any filters
+var varTemplateRegex = regexp.MustCompile(`\[\[(var:)?([A-Za-z0-9_.-]+)((?:\|[^\[\]|]*)*)\]\]`)
+
+// Matches [[env:NAME]] and [[env:NAME:default]], along with any filters
+var envTemplateRegex = regexp.MustCompile(`\[\[env:([A-Za-z_][A-Za-z0-9_]*)(:[^\[\]|]*)?((?:\|[^\[\]|]*)*)\]\]`)
+
+// A flag that can be given more than once, i.e. -var collab=xyz.oastify.com -var token=abc
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ", ")
+}
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// Merge the config file's vars with any -var flags, which take precedence. Names are case-insensitive, as the config
+// file's keys are lowercased when loaded
+func resolveVars(fileVars map[string]string, flagVars []string) map[string]string {
+	vars := make(map[string]string)
+	for name, value := range fileVars {
+		vars[strings.ToLower(name)] = value
+	}
+	for _, variable := range flagVars {
+		parts := strings.SplitN(variable, "=", 2)
+		vars[strings.ToLower(strings.TrimSpace(parts[0]))] = parts[1]
+	}
+	return vars
+}
+
+// Replace variable and [[env:NAME]] templates with their values. [[var:name]] must be defined, while the [[name]]
+// shorthand is left alone when there's no such variable (or it's a built-in template), so it can still be expanded later on
+func expandVars(value string, vars map[string]string) (string, error) {
+	if !strings.Contains(value, "[[") {
+		return value, nil
+	}
+
+	var err error
+	expanded := varTemplateRegex.ReplaceAllStringFunc(value, func(template string) string {
+		match := varTemplateRegex.FindStringSubmatch(template)
+		name := strings.ToLower(match[2])
+		_, filters := splitTemplateFilters(strings.TrimSuffix(strings.TrimPrefix(template, "[["), "]]"))
+
+		varValue, exists := vars[name]
+		if match[1] == "" && (!exists || isKnownTemplate(name)) {
+			return template
+		}
+
+		if !exists {
+			if err == nil {
+				err = errors.New(fmt.Sprintf("undefined variable %q in template %q", match[2], template))
+			}
+			return template
+		}
+
+		if filterErr := validateTemplateFilters(template, filters); filterErr != nil {
+			if err == nil {
+				err = filterErr
+			}
+			return template
+		}
+		return applyTemplateFilters(varValue, filters)
+	})
+	if err != nil {
+		return expanded, err
+	}
+
+	// Environment variables are expanded after config variables, so a variable's value can reference one
+	return expandEnvTemplates(expanded)
+}
+
+// Replace [[env:NAME]] templates with the environment variable's value, erroring if it's not set and there's no default
+func expandEnvTemplates(value string) (string, error) {
+	var err error
+	expanded := envTemplateRegex.ReplaceAllStringFunc(value, func(template string) string {
+		match := envTemplateRegex.FindStringSubmatch(template)
+		_, filters := splitTemplateFilters(strings.TrimSuffix(strings.TrimPrefix(template, "[["), "]]"))
+
+		envValue, exists := os.LookupEnv(match[1])
+		if !exists {
+			if match[2] == "" {
+				if err == nil {
+					err = errors.New(fmt.Sprintf("environment variable %v referenced in template %q is not set (use [[env:%v:default]] to provide a default)", match[1], template, match[1]))
+				}
+				return template
+			}
+			envValue = strings.TrimPrefix(match[2], ":")
+		}
+
+		if filterErr := validateTemplateFilters(template, filters); filterErr != nil {
+			if err == nil {
+				err = filterErr
+			}
+			return template
+		}
+		return applyTemplateFilters(envValue, filters)
+	})
+	return expanded, err
+}
+
+func expandVarsInList(values []string, vars map[string]string) ([]string, error) {
+	// Keep unset lists nil, as expectations treat any non-nil list as a check to make
+	if values == nil {
+		return nil, nil
+	}
+
+	expanded := make([]string, 0, len(values))
+	for _, value := range values {
+		value, err := expandVars(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded, nil
+}
+
+func expandVarsInMap(values map[string]string, vars map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	expanded := make(map[string]string)
+	for key, value := range values {
+		value, err := expandVars(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		expanded[key] = value
+	}
+	return expanded, nil
+}
+
+// Expand variables in everything a rule sends or matches on
+func expandRuleVars(ruleData Rule, vars map[string]string) (Rule, error) {
+	var err error
+	if ruleData.Injections, err = expandVarsInList(ruleData.Injections, vars); err != nil {
+		return ruleData, err
+	}
+	if ruleData.XmlBody, err = expandVars(ruleData.XmlBody, vars); err != nil {
+		return ruleData, err
+	}
+	if ruleData.JsonBody, err = expandVars(ruleData.JsonBody, vars); err != nil {
+		return ruleData, err
+	}
+	if ruleData.Expectation, err = expandExpectationVars(ruleData.Expectation, vars); err != nil {
+		return ruleData, err
+	}
+	for i, expectation := range ruleData.Expectations {
+		if ruleData.Expectations[i], err = expandExpectationVars(expectation, vars); err != nil {
+			return ruleData, err
+		}
+	}
+	if ruleData.Headers, err = expandVarsInMap(ruleData.Headers, vars); err != nil {
+		return ruleData, err
+	}
+	for i, step := range ruleData.Verify {
+		if ruleData.Verify[i].Injection, err = expandVars(step.Injection, vars); err != nil {
+			return ruleData, err
+		}
+		if ruleData.Verify[i].Expectation, err = expandExpectationVars(step.Expectation, vars); err != nil {
+			return ruleData, err
+		}
+	}
+	return ruleData, nil
+}
+
+func expandExpectationVars(expectation ExpectedResponse, vars map[string]string) (ExpectedResponse, error) {
+	var err error
+	if expectation.Contents, err = expandVarsInList(expectation.Contents, vars); err != nil {
+		return expectation, err
+	}
+	if expectation.Headers, err = expandVarsInMap(expectation.Headers, vars); err != nil {
+		return expectation, err
+	}
+	if expectation.NotContains, err = expandVarsInList(expectation.NotContains, vars); err != nil {
+		return expectation, err
+	}
+	if expectation.JsonPath, err = expandVarsInMap(expectation.JsonPath, vars); err != nil {
+		return expectation, err
+	}
+	for name, matcher := range expectation.HeaderMatchers {
+		if matcher.Contains, err = expandVars(matcher.Contains, vars); err != nil {
+			return expectation, err
+		}
+		expectation.HeaderMatchers[name] = matcher
+	}
+	return expectation, nil
+}
+
+// Expand variables in the headers, cookies and bodies sent with every request, and in the Slack and oob settings
+func expandGlobalVars(c *Config, vars map[string]string) error {
+	var err error
+	if c.Headers, err = expandVarsInMap(c.Headers, vars); err != nil {
+		return errors.New(fmt.Sprintf("headers: %v", err))
+	}
+	if c.Cookies, err = expandVars(c.Cookies, vars); err != nil {
+		return errors.New(fmt.Sprintf("cookies: %v", err))
+	}
+	if c.XmlBody, err = expandVars(c.XmlBody, vars); err != nil {
+		return errors.New(fmt.Sprintf("XML body: %v", err))
+	}
+	if c.Body, err = expandVars(c.Body, vars); err != nil {
+		return errors.New(fmt.Sprintf("body: %v", err))
+	}
+	if c.Slack != nil {
+		for _, value := range []*string{&c.Slack.Channel, &c.Slack.BotToken, &c.Slack.BotTokenFile, &c.Slack.BotTokenEnv} {
+			if *value, err = expandVars(*value, vars); err != nil {
+				return errors.New(fmt.Sprintf("slack: %v", err))
+			}
+		}
+		for _, channels := range []*map[string]string{&c.Slack.SeverityChannels, &c.Slack.TagChannels} {
+			if *channels, err = expandVarsInMap(*channels, vars); err != nil {
+				return errors.New(fmt.Sprintf("slack: %v", err))
+			}
+		}
+	}
+	if c.Oob, err = expandVarsInMap(c.Oob, vars); err != nil {
+		return errors.New(fmt.Sprintf("oob: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Set an environment variable for the test, restoring it (or unsetting it) when the test finishes
+func setEnv(t *testing.T, name string, value string) {
+	t.Helper()
+	original, existed := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, original)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func unsetEnv(t *testing.T, name string) {
+	t.Helper()
+	original, existed := os.LookupEnv(name)
+	os.Unsetenv(name)
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, original)
+		}
+	})
+}
+
+func TestExpandEnvTemplates(t *testing.T) {
+	setEnv(t, "QSFUZZ_TEST_DOMAIN", "abc.oastify.com")
+	setEnv(t, "QSFUZZ_TEST_EMPTY", "")
+	unsetEnv(t, "QSFUZZ_TEST_UNSET")
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"whole value", "[[env:QSFUZZ_TEST_DOMAIN]]", "abc.oastify.com"},
+		{"inside a payload", "http://[[env:QSFUZZ_TEST_DOMAIN]]/callback?x=1", "http://abc.oastify.com/callback?x=1"},
+		{"more than once", "'\"><img src=//[[env:QSFUZZ_TEST_DOMAIN]]/a onerror=fetch('//[[env:QSFUZZ_TEST_DOMAIN]]/b')>", "'\"><img src=//abc.oastify.com/a onerror=fetch('//abc.oastify.com/b')>"},
+		{"next to other templates", "[[param]]-[[env:QSFUZZ_TEST_DOMAIN]]-[[random]]", "[[param]]-abc.oastify.com-[[random]]"},
+		{"with a filter", "x=[[env:QSFUZZ_TEST_DOMAIN|b64]]", "x=YWJjLm9hc3RpZnkuY29t"},
+		{"default when unset", "http://[[env:QSFUZZ_TEST_UNSET:fallback.example.com]]/", "http://fallback.example.com/"},
+		{"default with colons", "[[env:QSFUZZ_TEST_UNSET:http://a.example.com:8080]]", "http://a.example.com:8080"},
+		{"empty default", "a[[env:QSFUZZ_TEST_UNSET:]]b", "ab"},
+		{"default with a filter", "[[env:QSFUZZ_TEST_UNSET:Abc|lower]]", "abc"},
+		{"default ignored when set", "[[env:QSFUZZ_TEST_DOMAIN:fallback.example.com]]", "abc.oastify.com"},
+		{"set but empty beats the default", "a[[env:QSFUZZ_TEST_EMPTY:fallback]]b", "ab"},
+		{"no templates", "' OR 1=1-- -", "' OR 1=1-- -"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := expandEnvTemplates(test.value)
+			if err != nil {
+				t.Fatalf("expandEnvTemplates(%q) returned %v", test.value, err)
+			}
+			if got != test.want {
+				t.Errorf("expandEnvTemplates(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnvTemplatesErrors(t *testing.T) {
+	unsetEnv(t, "QSFUZZ_TEST_UNSET")
+
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{"http://[[env:QSFUZZ_TEST_UNSET]]/", "environment variable QSFUZZ_TEST_UNSET referenced in template \"[[env:QSFUZZ_TEST_UNSET]]\" is not set"},
+		{"[[env:QSFUZZ_TEST_UNSET:x|nope]]", "invalid filter \"nope\""},
+	}
+
+	for _, test := range tests {
+		_, err := expandEnvTemplates(test.value)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expandEnvTemplates(%q) = %v, want an error containing %q", test.value, err, test.err)
+		}
+	}
+}
+
+// Config variables are expanded first, so their values can reference environment variables
+func TestExpandVarsWithEnvTemplates(t *testing.T) {
+	setEnv(t, "QSFUZZ_TEST_TOKEN", "s3cret")
+
+	vars := map[string]string{"auth": "Bearer [[env:QSFUZZ_TEST_TOKEN]]"}
+	got, err := expandVars("x=[[var:auth]]&y=[[env:QSFUZZ_TEST_TOKEN]]", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x=Bearer s3cret&y=s3cret"; got != want {
+		t.Errorf("expandVars = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// How long a verifyCommand can take when the rule doesn't set verifyTimeout, which allows for a browser starting up
+const defaultVerifyTimeout = 30
+
+// Catch a verifyCommand that could never run before any requests are sent
+func validateVerifyCommand(ruleData Rule) error {
+	if ruleData.VerifyTimeout < 0 {
+		return errors.New("verifyTimeout can't be negative")
+	}
+	if ruleData.VerifyCommand == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		return errors.New("verifyCommand needs sh to be installed")
+	}
+	return nil
+}
+
+// Run the rule's verifyCommand for a match, which is only reported if it exits 0. The command runs through sh, with the
+// matched URL as $1 and in QSFUZZ_URL, rather than templated into the command, so payloads can't break out of it
+func verifyMatch(t Task) bool {
+	timeout := t.RuleData.VerifyTimeout
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.RuleData.VerifyCommand, "qsfuzz", t.Url)
+	cmd.Env = append(os.Environ(),
+		"QSFUZZ_URL="+t.Url,
+		"QSFUZZ_RULE="+t.RuleName,
+		"QSFUZZ_PARAM="+t.Param,
+		"QSFUZZ_METHOD="+t.Method,
+		"QSFUZZ_BODY="+t.Body,
+	)
+	if opts.Debug {
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		if opts.Debug {
+			printRed(os.Stderr, "[%v] verifyCommand rejected match for %v: %v\n", t.RuleName, t.Url, err)
+		}
+		return false
+	}
+	return true
+}
+
+// A follow-up request sent when a rule first matches, to rule out false positives (i.e. SLEEP(0) after SLEEP(5), or a
+// fresh canary to rule out caching). Its injection is sent to the same place as the matched payload
+type VerifyStep struct {
+	Injection   string           `mapstructure:"injection"`
+	Expectation ExpectedResponse `mapstructure:"expectation"`
+	// Whether the follow-up response should match the expectation (the default) or not (i.e. SLEEP(0) not being slow)
+	Match *bool `mapstructure:"match"`
+}
+
+func (s VerifyStep) expectsMatch() bool {
+	return s.Match == nil || *s.Match
+}
+
+func validateVerifySteps(ruleData Rule, oobDomain string) (Rule, error) {
+	if ruleData.Verify == nil {
+		return ruleData, nil
+	}
+
+	// The steps are copied, as the config's may be shared when reloading
+	steps := make([]VerifyStep, 0, len(ruleData.Verify))
+	for i, step := range ruleData.Verify {
+		if step.Injection == "" {
+			return ruleData, errors.New(fmt.Sprintf("verify[%v]: needs an injection", i))
+		}
+		if err := validateTemplates(step.Injection, oobDomain); err != nil {
+			return ruleData, errors.New(fmt.Sprintf("verify[%v].injection: %v", i, err))
+		}
+		// Interactions can arrive long after the follow-up request, so they can't confirm a match in time
+		if usesOobTemplate(step.Injection) {
+			return ruleData, errors.New(fmt.Sprintf("verify[%v].injection: can't use [[oob]]", i))
+		}
+		if !step.Expectation.hasMatchers() {
+			return ruleData, errors.New(fmt.Sprintf("verify[%v].expectation: no matchers", i))
+		}
+
+		expectation, err := loadExpectation(step.Expectation, ruleData.getTimeoutSeconds())
+		if err != nil {
+			return ruleData, errors.New(fmt.Sprintf("verify[%v].expectation: %v", i, err))
+		}
+		step.Expectation = expectation
+		steps = append(steps, step)
+	}
+	ruleData.Verify = steps
+	return ruleData, nil
+}
+
+// Send each of the rule's verify steps for a match, in order, from the same worker. The match is only reported if
+// every follow-up response matches its expectation (or doesn't, for steps with match: false). Returns a description
+// of each follow-up request for the finding
+func verifyWithRequests(t Task) ([]string, bool) {
+	var verification []string
+	for i, step := range t.RuleData.Verify {
+		if i >= len(t.VerifyTasks) {
+			if opts.Debug {
+				printRed(os.Stderr, "[%v] unable to send verify[%v] to %v for %v\n", t.RuleName, i, describeInjectionPoint(t), t.Url)
+			}
+			return nil, false
+		}
+
+		followUp := t.VerifyTasks[i]
+		resp, err := sendRequest(followUp)
+		if err != nil {
+			if opts.Debug {
+				printRed(os.Stderr, "[%v] error sending verify[%v] request to %v: %v\n", t.RuleName, i, followUp.Url, describeRequestError(followUp.Url, err))
+			}
+			return nil, false
+		}
+
+		// Responses of other content types never match, as their bodies weren't read
+		matched := false
+		var details []string
+		if t.RuleData.matchesContentType(resp.Headers) {
+			_, details, matched = evaluateExpectation(resp, followUp, step.Expectation)
+		}
+		outcome := "didn't match, as expected"
+		if matched {
+			outcome = "matched"
+			if details != nil {
+				outcome = fmt.Sprintf("matched (%v)", strings.Join(details, ", "))
+			}
+		}
+		description := fmt.Sprintf("%v [status %v, %vms] %v", describeRequest(followUp.Method, fullyDecode(followUp.Url)), resp.StatusCode, resp.Duration.Milliseconds(), outcome)
+
+		if matched != step.expectsMatch() {
+			if opts.Debug {
+				printRed(os.Stderr, "[%v] verify[%v] rejected match for %v: %v\n", t.RuleName, i, t.Url, strings.TrimSuffix(description, ", as expected"))
+			}
+			return nil, false
+		}
+		verification = append(verification, description)
+	}
+	return verification, true
+}
+
+// Build the follow-up requests for the verify steps of a rule's tasks, by generating each step's injection for the URL
+// like the rule's own and picking the one at each request's parameter and location, so every injection mode is
+// supported. They're built with the tasks rather than once one matches, as the workers can't share the random source
+// templates draw from, and so runs with the same -seed send the same follow-ups
+func addVerifyTasks(tasks []Task, u *url.URL) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	type injectionPoint struct {
+		param    string
+		location string
+	}
+	for stepIndex, step := range tasks[0].RuleData.Verify {
+		ruleData := tasks[0].RuleData
+		ruleData.Injections = []string{step.Injection}
+		injections, err := getRuleInjections(u, ruleData)
+		if err != nil {
+			return
+		}
+
+		candidates := make(map[injectionPoint]Injection)
+		for _, candidate := range injections {
+			point := injectionPoint{param: candidate.Param, location: candidate.Location}
+			if _, exists := candidates[point]; !exists {
+				candidates[point] = candidate
+			}
+		}
+
+		for i, t := range tasks {
+			// Tasks without a follow-up for an earlier step can't be verified anyway
+			if len(t.VerifyTasks) < stepIndex {
+				continue
+			}
+			candidate, exists := candidates[injectionPoint{param: t.Param, location: t.Location}]
+			if !exists {
+				continue
+			}
+			candidate = addRequestBody(candidate, u)
+			candidate.Method = t.Method
+
+			followUp := t
+			followUp.Injection = candidate
+			followUp.VerifyTasks = nil
+			followUp.Headers, followUp.Cookies = getRequestHeaders(u, t.RuleData, candidate.Param)
+			tasks[i].VerifyTasks = append(tasks[i].VerifyTasks, followUp)
+		}
+	}
+}
+
+func describeInjectionPoint(t Task) string {
+	if t.Location != "" {
+		return t.Location
+	}
+	return t.Param
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Editors often write a file in several steps, so wait for changes to settle before reloading
+const configReloadDelay = 200 * time.Millisecond
+
+// Guards config.Rules, which can be swapped out by -watch while requests are being generated
+var rulesMutex sync.RWMutex
+
+// The current set of rules. The map is replaced rather than modified on reload, so callers can keep using it
+func getRules() map[string]Rule {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+	return config.Rules
+}
+
+// Watch the config files and reload their rules whenever any of them change. Directories are watched rather than the
+// files, as many editors save by replacing the file entirely
+func watchConfig(configFiles []string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	configPaths := make(map[string]bool)
+	for _, configFile := range configFiles {
+		configPath, err := filepath.Abs(configFile)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		configPaths[configPath] = true
+
+		if err := watcher.Add(filepath.Dir(configPath)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if configPaths[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					reload = time.After(configReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if opts.Debug {
+					printRed(os.Stderr, "error watching config file: %v\n", err)
+				}
+			case <-reload:
+				reload = nil
+				reloadRules(configFiles)
+			}
+		}
+	}()
+	return nil
+}
+
+// Swap in the rules from the config files, keeping the current ones if it fails to load. Everything else (headers,
+// cookies, Slack and oob settings) stays as it was when qsfuzz started
+func reloadRules(configFiles []string) {
+	loaded, err := readConfig(configFiles, Config{XmlBody: config.XmlBody, Body: config.Body, BodyContentType: config.BodyContentType})
+	if err != nil {
+		printRed(os.Stderr, "Failed reloading config, keeping the previous rules: %v\n", err)
+		return
+	}
+
+	rulesMutex.Lock()
+	config.Rules = loaded.Rules
+	rulesMutex.Unlock()
+
+	if !opts.SilentMode {
+		printCyan(os.Stderr, "Reloaded %v rules from %v\n", len(loaded.Rules), strings.Join(configFiles, ", "))
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const xmlContentType = "text/xml; charset=utf-8"
+
+type xmlInjectionPoint struct {
+	start    int
+	end      int
+	name     string
+	location string
+}
+
+func getInjectedXmlBodies(u *url.URL, template string, ruleInjections []string, rawXml bool) ([]Injection, error) {
+	points, err := getXmlInjectionPoints(template)
+	if err != nil {
+		return nil, err
+	}
+
+	var injectedBodies []Injection
+	for _, ruleInjection := range ruleInjections {
+		injection := expandTemplatedValues(ruleInjection, u)
+
+		for _, point := range points {
+			payload := expandRequestTemplates(injection, point.name)
+			injected := payload
+			// Escape payloads so the document stays well-formed, unless the rule explicitly wants to break it (i.e. XXE)
+			if !rawXml {
+				injected = escapeXml(injected)
+			}
+
+			body := template[:point.start] + injected + template[point.end:]
+			injectedBodies = append(injectedBodies, Injection{
+				Url:          u.String(),
+				Method:       "POST",
+				Body:         body,
+				ContentType:  xmlContentType,
+				Param:        point.name,
+				Location:     point.location,
+				Payload:      injection,
+				SentPayloads: []string{payload},
+			})
+		}
+	}
+	return injectedBodies, nil
+}
+
+// Walk the raw XML tokens (to keep namespace prefixes as written) and record the byte span of every
+// non-whitespace text node and attribute value, along with an XPath-like location for each
+func getXmlInjectionPoints(template string) ([]xmlInjectionPoint, error) {
+	decoder := xml.NewDecoder(strings.NewReader(template))
+
+	var points []xmlInjectionPoint
+	var path []string
+	// Element names without sibling indexes, for [[param]]
+	var names []string
+	// Count child element names per level so repeated siblings get an XPath style index (i.e. item[2])
+	siblings := []map[string]int{{}}
+
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end := int(decoder.InputOffset())
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := qualifiedXmlName(t.Name)
+			names = append(names, name)
+			counts := siblings[len(siblings)-1]
+			counts[name] += 1
+			if counts[name] > 1 {
+				name = fmt.Sprintf("%s[%d]", name, counts[name])
+			}
+			path = append(path, name)
+			siblings = append(siblings, make(map[string]int))
+
+			elementPath := "/" + strings.Join(path, "/")
+			spans := getXmlAttributeValueSpans(template[start:end])
+			for i, attr := range t.Attr {
+				if i >= len(spans) {
+					break
+				}
+				// Namespace declarations aren't worth fuzzing and changing them only breaks the document
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				points = append(points, xmlInjectionPoint{
+					start:    start + spans[i][0],
+					end:      start + spans[i][1],
+					name:     qualifiedXmlName(attr.Name),
+					location: fmt.Sprintf("%s/@%s", elementPath, qualifiedXmlName(attr.Name)),
+				})
+			}
+		case xml.EndElement:
+			if len(path) == 0 {
+				return nil, errors.New("unexpected closing tag " + qualifiedXmlName(t.Name))
+			}
+			path = path[:len(path)-1]
+			names = names[:len(names)-1]
+			siblings = siblings[:len(siblings)-1]
+		case xml.CharData:
+			if len(path) == 0 || len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			points = append(points, xmlInjectionPoint{
+				start:    start,
+				end:      end,
+				name:     names[len(names)-1],
+				location: "/" + strings.Join(path, "/") + "/text()",
+			})
+		}
+	}
+
+	if len(path) != 0 {
+		return nil, errors.New("unclosed element " + path[len(path)-1])
+	}
+
+	return points, nil
+}
+
+// Find the start and end offsets of each quoted attribute value within a raw start tag, in document order
+func getXmlAttributeValueSpans(rawTag string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(rawTag); i++ {
+		if rawTag[i] != '=' {
+			continue
+		}
+		j := i + 1
+		for j < len(rawTag) && strings.ContainsRune(" \t\r\n", rune(rawTag[j])) {
+			j++
+		}
+		if j >= len(rawTag) || (rawTag[j] != '"' && rawTag[j] != '\'') {
+			continue
+		}
+		closing := strings.IndexByte(rawTag[j+1:], rawTag[j])
+		if closing == -1 {
+			break
+		}
+		spans = append(spans, [2]int{j + 1, j + 1 + closing})
+		i = j + 1 + closing
+	}
+	return spans
+}
+
+func qualifiedXmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func escapeXml(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}